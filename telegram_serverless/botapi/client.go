@@ -0,0 +1,182 @@
+// Package botapi is the Bot API client shared by the manager and the gateway
+package botapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// CloudAPIURL is the address of Telegram's hosted Bot API
+const CloudAPIURL = "https://api.telegram.org"
+
+// Client is safe for concurrent use
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	uploadClient *http.Client // allows for large files, which take longer than regular calls
+}
+
+// InputFile is an upload of a multipart method call
+type InputFile struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Reader      io.Reader
+}
+
+// NewClient returns a client of the Bot API server at baseURL. timeout bounds regular
+// calls, uploadTimeout calls that upload files.
+func NewClient(baseURL string, timeout, uploadTimeout time.Duration) *Client {
+	return &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		httpClient:   &http.Client{Timeout: timeout},
+		uploadClient: &http.Client{Timeout: uploadTimeout},
+	}
+}
+
+// WithBaseURL returns a client that talks to another Bot API server.
+// An empty baseURL keeps the current server.
+func (c *Client) WithBaseURL(baseURL string) *Client {
+	if baseURL == "" || baseURL == c.baseURL {
+		return c
+	}
+
+	clone := *c
+	clone.baseURL = strings.TrimSuffix(baseURL, "/")
+	return &clone
+}
+
+// BaseURL returns the Bot API server the client talks to
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+func (c *Client) methodURL(botToken, method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", c.baseURL, botToken, method)
+}
+
+// Call makes a typed method call, decoding the method's result into result unless it is nil
+func (c *Client) Call(ctx context.Context, botToken, method string, params, result interface{}) error {
+	raw, err := c.Post(ctx, botToken, method, params)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("failed to unmarshal %s result: %w", method, err)
+	}
+	return nil
+}
+
+// Post sends params as a JSON body and returns the method's raw result; nil params
+// send an empty body
+func (c *Client) Post(ctx context.Context, botToken, method string, params interface{}) (json.RawMessage, error) {
+	var body []byte
+	if params != nil {
+		var err error
+		body, err = json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal params: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.methodURL(botToken, method), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(c.httpClient, req, method)
+}
+
+// PostMultipart calls method with params as form fields and files as uploads.
+// The files are streamed into the request rather than buffered.
+func (c *Client) PostMultipart(ctx context.Context, botToken, method string, params map[string]interface{}, files []InputFile) (json.RawMessage, error) {
+	body, bodyWriter := io.Pipe()
+	defer body.Close()
+
+	form := multipart.NewWriter(bodyWriter)
+	go func() {
+		bodyWriter.CloseWithError(writeForm(form, params, files))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.methodURL(botToken, method), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	return c.do(c.uploadClient, req, method)
+}
+
+func (c *Client) do(httpClient *http.Client, req *http.Request, method string) (json.RawMessage, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return DecodeResponse(method, resp.StatusCode, body)
+}
+
+// writeForm encodes params the way the Bot API reads form fields: strings as they are,
+// everything else, including objects such as reply_markup or media, as JSON
+func writeForm(form *multipart.Writer, params map[string]interface{}, files []InputFile) error {
+	for name, value := range params {
+		field, ok := value.(string)
+		if !ok {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("failed to marshal param %s: %w", name, err)
+			}
+			field = string(encoded)
+		}
+		if err := form.WriteField(name, field); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		filename := file.Filename
+		if filename == "" {
+			filename = file.Field
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(file.Field), quoteEscaper.Replace(filename)))
+		header.Set("Content-Type", contentType)
+
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Reader); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", file.Field, err)
+		}
+	}
+
+	return form.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
@@ -0,0 +1,60 @@
+package botapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// response is the envelope of every Bot API answer
+type response struct {
+	Ok          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	Description string              `json:"description"`
+	ErrorCode   int                 `json:"error_code"`
+	Parameters  *ResponseParameters `json:"parameters"`
+}
+
+// ResponseParameters tell how a failed request can be repeated
+type ResponseParameters struct {
+	MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+	RetryAfter      int   `json:"retry_after,omitempty"`
+}
+
+// Error is an error reported by the Bot API itself, as opposed to a transport failure
+type Error struct {
+	ErrorCode       int
+	Description     string
+	RetryAfter      int   // seconds to wait after a flood limit error
+	MigrateToChatID int64 // the supergroup a group was upgraded to; resend there
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("telegram api error [%d]: %s", e.ErrorCode, e.Description)
+}
+
+// DecodeResponse returns the result of a Bot API answer, or an *Error if the call failed.
+// The Bot API describes its errors in the body, whatever the status code.
+func DecodeResponse(method string, statusCode int, body []byte) (json.RawMessage, error) {
+	var resp response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned status %d: %s", method, statusCode, string(body))
+		}
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if !resp.Ok {
+		apiErr := &Error{ErrorCode: resp.ErrorCode, Description: resp.Description}
+		if apiErr.ErrorCode == 0 {
+			apiErr.ErrorCode = statusCode
+		}
+		if resp.Parameters != nil {
+			apiErr.RetryAfter = resp.Parameters.RetryAfter
+			apiErr.MigrateToChatID = resp.Parameters.MigrateToChatID
+		}
+		return nil, apiErr
+	}
+
+	return resp.Result, nil
+}
@@ -0,0 +1,83 @@
+package botapi
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		wantResult string
+		wantErr    *Error
+		wantOther  bool // a failure that isn't an *Error
+	}{
+		{
+			name:       "ok",
+			statusCode: http.StatusOK,
+			body:       `{"ok":true,"result":{"message_id":7}}`,
+			wantResult: `{"message_id":7}`,
+		},
+		{
+			name:       "flood limit",
+			statusCode: http.StatusTooManyRequests,
+			body:       `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 12","parameters":{"retry_after":12}}`,
+			wantErr:    &Error{ErrorCode: 429, Description: "Too Many Requests: retry after 12", RetryAfter: 12},
+		},
+		{
+			name:       "migrated group",
+			statusCode: http.StatusBadRequest,
+			body:       `{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1001234567890}}`,
+			wantErr:    &Error{ErrorCode: 400, Description: "Bad Request: group chat was upgraded to a supergroup chat", MigrateToChatID: -1001234567890},
+		},
+		{
+			name:       "error code from the status",
+			statusCode: http.StatusBadGateway,
+			body:       `{"ok":false,"description":"Bad Gateway"}`,
+			wantErr:    &Error{ErrorCode: http.StatusBadGateway, Description: "Bad Gateway"},
+		},
+		{
+			name:       "not json",
+			statusCode: http.StatusBadGateway,
+			body:       `<html>502 Bad Gateway</html>`,
+			wantOther:  true,
+		},
+		{
+			name:       "malformed ok response",
+			statusCode: http.StatusOK,
+			body:       `{"ok":tru`,
+			wantOther:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := DecodeResponse("sendMessage", tt.statusCode, []byte(tt.body))
+
+			var apiErr *Error
+			switch {
+			case tt.wantErr != nil:
+				if !errors.As(err, &apiErr) {
+					t.Fatalf("DecodeResponse() error = %v, want *Error", err)
+				}
+				if *apiErr != *tt.wantErr {
+					t.Errorf("DecodeResponse() error = %+v, want %+v", *apiErr, *tt.wantErr)
+				}
+			case tt.wantOther:
+				if err == nil || errors.As(err, &apiErr) {
+					t.Fatalf("DecodeResponse() error = %v, want a non-api error", err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("DecodeResponse() error = %v", err)
+				}
+				if string(result) != tt.wantResult {
+					t.Errorf("DecodeResponse() result = %s, want %s", result, tt.wantResult)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/uchebnick/telegram-serverless/botapi
+
+go 1.25
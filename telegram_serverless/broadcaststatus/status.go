@@ -0,0 +1,73 @@
+// Package broadcaststatus owns the status transitions of broadcasts, which both the
+// manager (pause, resume, cancel) and the gateway (start, complete) make
+package broadcaststatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Broadcasts live in a hash at broadcast:<id>, with recipients in the list
+// broadcast:<id>:recipients. ActiveKey holds the ids gateways still have to work on.
+const ActiveKey = "broadcasts:active"
+
+// FinishedTTL is how long a completed or cancelled broadcast stays around for its stats
+const FinishedTTL = 7 * 24 * time.Hour
+
+// ErrNotFound is returned for broadcasts that don't exist (any more)
+var ErrNotFound = errors.New("broadcast not found")
+
+// setStatusScript changes the status only from one of the allowed statuses. A finished
+// broadcast leaves the active set and expires along with its recipients.
+// KEYS: hash, active set, recipients. ARGV: status, now, ttl, id, allowed statuses...
+var setStatusScript = redis.NewScript(`
+local status = redis.call("HGET", KEYS[1], "status")
+if not status then
+	return -1
+end
+for i = 5, #ARGV do
+	if ARGV[i] == status then
+		redis.call("HSET", KEYS[1], "status", ARGV[1], "updated_at", ARGV[2])
+		if ARGV[1] == "cancelled" or ARGV[1] == "completed" then
+			redis.call("HSET", KEYS[1], "completed_at", ARGV[2])
+			redis.call("SREM", KEYS[2], ARGV[4])
+			redis.call("EXPIRE", KEYS[1], ARGV[3])
+			redis.call("EXPIRE", KEYS[3], ARGV[3])
+		end
+		return 1
+	end
+end
+return 0`)
+
+// Key returns the key of a broadcast's hash
+func Key(id string) string {
+	return fmt.Sprintf("broadcast:%s", id)
+}
+
+// RecipientsKey returns the key of a broadcast's recipient list
+func RecipientsKey(id string) string {
+	return fmt.Sprintf("broadcast:%s:recipients", id)
+}
+
+// Set moves a broadcast to status if its current status is one of from.
+// It reports false when the broadcast is in another status.
+func Set(ctx context.Context, client redis.Scripter, id, status string, from ...string) (bool, error) {
+	args := []interface{}{status, time.Now().Unix(), int64(FinishedTTL.Seconds()), id}
+	for _, s := range from {
+		args = append(args, s)
+	}
+
+	keys := []string{Key(id), ActiveKey, RecipientsKey(id)}
+	result, err := setStatusScript.Run(ctx, client, keys, args...).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to update broadcast status: %w", err)
+	}
+	if result == -1 {
+		return false, ErrNotFound
+	}
+	return result == 1, nil
+}
@@ -35,6 +35,7 @@ func main() {
 	logger.Infow("starting manager",
 		"port", cfg.Port,
 		"kafka_brokers", cfg.KafkaBrokers,
+		"telegram_api_url", cfg.TelegramAPIURL,
 		"worker_namespace", cfg.WorkerNamespace)
 
 	ctx := context.Background()
@@ -56,7 +57,7 @@ func main() {
 		logger.Fatalw("failed to connect to kubernetes", "error", err)
 	}
 
-	tgClient := telegram.NewClient(cfg.GatewayURL, logger)
+	tgClient := telegram.NewClient(cfg.TelegramAPIURL, logger)
 
 	kafkaBrokersStr := strings.Join(cfg.KafkaBrokers, ",")
 	botService := bot.NewService(
@@ -70,12 +71,26 @@ func main() {
 		logger,
 	)
 
+	webhookMonitor := bot.NewWebhookMonitor(botService, cfg.WebhookCheckInterval, logger)
+
 	apiHandlers := handlers.NewHandlers(botService, logger)
 
 	apiServer := routes.NewServer(apiHandlers, logger)
 
 	metricsSrv := newMetricsServer(cfg.MetricsPort, logger)
 
+	monitorCtx, stopMonitor := context.WithCancel(ctx)
+	defer stopMonitor()
+
+	go webhookMonitor.Start(monitorCtx)
+
+	// Not fatal: bots keep working with the topics they have, and the next start tries again
+	go func() {
+		if err := botService.EnsureTopics(monitorCtx); err != nil {
+			logger.Errorw("failed to ensure bot topics", "error", err)
+		}
+	}()
+
 	go func() {
 		if err := apiServer.Start(cfg.Port); err != nil {
 			logger.Fatalw("handlers server error", "error", err)
@@ -94,6 +109,8 @@ func main() {
 
 	logger.Info("shutting down gracefully...")
 
+	stopMonitor()
+
 	if err := apiServer.Shutdown(); err != nil {
 		logger.Errorw("handlers server shutdown error", "error", err)
 	}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/broadcaststatus"
+	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+)
+
+// ErrInvalidTransition is returned for status changes the broadcast's current status doesn't allow
+var ErrInvalidTransition = errors.New("invalid broadcast status transition")
+
+// maxBroadcastRecipients keeps a single broadcast request within reason
+const maxBroadcastRecipients = 1_000_000
+
+// CreateBroadcast stores a broadcast; a gateway replica picks it up and sends it
+func (s *Service) CreateBroadcast(ctx context.Context, botID string, req *models.CreateBroadcastRequest) (*models.Broadcast, error) {
+	if _, err := s.storage.GetBot(ctx, botID); err != nil {
+		return nil, err
+	}
+
+	if req.Method == "" {
+		req.Method = "sendMessage"
+	}
+	if len(req.Params) == 0 {
+		return nil, fmt.Errorf("%w: params are required", ErrInvalidRequest)
+	}
+	if _, ok := req.Params["chat_id"]; ok {
+		return nil, fmt.Errorf("%w: chat_id is set per recipient, use chat_ids", ErrInvalidRequest)
+	}
+
+	chatIDs := req.ChatIDs
+	if req.UseAudience {
+		audience, err := s.storage.AudienceChatIDs(ctx, botID)
+		if err != nil {
+			return nil, err
+		}
+		chatIDs = append(chatIDs, audience...)
+	}
+	chatIDs = uniqueChatIDs(chatIDs)
+
+	if len(chatIDs) == 0 {
+		return nil, fmt.Errorf("%w: no recipients", ErrInvalidRequest)
+	}
+	if len(chatIDs) > maxBroadcastRecipients {
+		return nil, fmt.Errorf("%w: at most %d recipients are allowed", ErrInvalidRequest, maxBroadcastRecipients)
+	}
+
+	now := time.Now()
+	broadcast := &models.Broadcast{
+		ID:        "bc_" + randomHex(8),
+		BotID:     botID,
+		Method:    req.Method,
+		Params:    req.Params,
+		Status:    models.BroadcastPending,
+		Total:     int64(len(chatIDs)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.storage.CreateBroadcast(ctx, broadcast, chatIDs); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("broadcast created", "bot_id", botID, "broadcast_id", broadcast.ID, "recipients", broadcast.Total)
+	return broadcast, nil
+}
+
+func (s *Service) GetBroadcast(ctx context.Context, broadcastID string) (*models.Broadcast, error) {
+	return s.storage.GetBroadcast(ctx, broadcastID)
+}
+
+func (s *Service) ListBroadcasts(ctx context.Context, botID string) ([]*models.Broadcast, error) {
+	ids, err := s.storage.ListBroadcasts(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	broadcasts := make([]*models.Broadcast, 0, len(ids))
+	for _, id := range ids {
+		broadcast, err := s.storage.GetBroadcast(ctx, id)
+		if errors.Is(err, broadcaststatus.ErrNotFound) {
+			// Finished broadcasts expire after broadcaststatus.FinishedTTL
+			if err := s.storage.ForgetBroadcast(ctx, botID, id); err != nil {
+				s.logger.Errorw("failed to forget expired broadcast", "broadcast_id", id, "error", err)
+			}
+			continue
+		}
+		if err != nil {
+			s.logger.Errorw("failed to get broadcast", "broadcast_id", id, "error", err)
+			continue
+		}
+		broadcasts = append(broadcasts, broadcast)
+	}
+
+	return broadcasts, nil
+}
+
+func (s *Service) PauseBroadcast(ctx context.Context, broadcastID string) error {
+	return s.setBroadcastStatus(ctx, broadcastID, models.BroadcastPaused,
+		models.BroadcastPending, models.BroadcastRunning)
+}
+
+func (s *Service) ResumeBroadcast(ctx context.Context, broadcastID string) error {
+	return s.setBroadcastStatus(ctx, broadcastID, models.BroadcastRunning,
+		models.BroadcastPaused)
+}
+
+func (s *Service) CancelBroadcast(ctx context.Context, broadcastID string) error {
+	return s.setBroadcastStatus(ctx, broadcastID, models.BroadcastCancelled,
+		models.BroadcastPending, models.BroadcastRunning, models.BroadcastPaused)
+}
+
+func (s *Service) setBroadcastStatus(ctx context.Context, broadcastID, status string, from ...string) error {
+	changed, err := s.storage.SetBroadcastStatus(ctx, broadcastID, status, from...)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return fmt.Errorf("%w: broadcast can't be %s in its current status", ErrInvalidTransition, status)
+	}
+
+	s.logger.Infow("broadcast status changed", "broadcast_id", broadcastID, "status", status)
+	return nil
+}
+
+func uniqueChatIDs(chatIDs []int64) []int64 {
+	seen := make(map[int64]bool, len(chatIDs))
+	unique := make([]int64, 0, len(chatIDs))
+	for _, chatID := range chatIDs {
+		if !seen[chatID] {
+			seen[chatID] = true
+			unique = append(unique, chatID)
+		}
+	}
+	return unique
+}
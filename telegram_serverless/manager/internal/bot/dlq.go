@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uchebnick/telegram-serverless/manager/internal/kafka"
+	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+)
+
+const (
+	dlqTopic = "dlq"
+
+	// maxDLQRead bounds how many entries a list or replay-all reads from Kafka
+	maxDLQRead = 10000
+)
+
+// ListDeadLetters returns up to limit live entries of the bot's dead-letter topic
+func (s *Service) ListDeadLetters(ctx context.Context, botID string, limit int) ([]*models.DLQEntry, error) {
+	if _, err := s.storage.GetBot(ctx, botID); err != nil {
+		return nil, err
+	}
+
+	return s.liveDeadLetters(ctx, botID, limit)
+}
+
+func (s *Service) GetDeadLetter(ctx context.Context, botID, entryID string) (*models.DLQEntry, error) {
+	if _, err := s.storage.GetBot(ctx, botID); err != nil {
+		return nil, err
+	}
+
+	entry, _, err := s.deadLetter(ctx, botID, entryID)
+	return entry, err
+}
+
+// ReplayDeadLetter sends the entry's command to the bot's outgoing topic again
+func (s *Service) ReplayDeadLetter(ctx context.Context, botID, entryID string) error {
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return err
+	}
+
+	entry, record, err := s.deadLetter(ctx, botID, entryID)
+	if err != nil {
+		return err
+	}
+
+	return s.replay(ctx, botConfig, entry, record.Key)
+}
+
+// ReplayDeadLetters replays every live entry and returns how many were replayed
+func (s *Service) ReplayDeadLetters(ctx context.Context, botID string) (int, error) {
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return 0, err
+	}
+
+	start, handled, err := s.dlqState(ctx, botID)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := s.kafkaAdmin.ReadRecords(ctx, botID, dlqTopic, start, maxDLQRead)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, record := range records {
+		entry, err := dlqEntry(record)
+		if err != nil || handled[entry.ID] {
+			continue
+		}
+		if err := s.replay(ctx, botConfig, entry, record.Key); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	s.logger.Infow("dead letters replayed", "bot_id", botID, "count", replayed)
+	return replayed, nil
+}
+
+// DiscardDeadLetter hides one entry without replaying it
+func (s *Service) DiscardDeadLetter(ctx context.Context, botID, entryID string) error {
+	if _, err := s.storage.GetBot(ctx, botID); err != nil {
+		return err
+	}
+
+	if _, _, err := s.deadLetter(ctx, botID, entryID); err != nil {
+		return err
+	}
+
+	return s.storage.MarkDLQHandled(ctx, botID, entryID)
+}
+
+// PurgeDeadLetters hides every entry currently in the dead-letter topic
+func (s *Service) PurgeDeadLetters(ctx context.Context, botID string) error {
+	if _, err := s.storage.GetBot(ctx, botID); err != nil {
+		return err
+	}
+
+	ends, err := s.kafkaAdmin.TopicEnds(ctx, botID, dlqTopic)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.PurgeDLQ(ctx, botID, ends); err != nil {
+		return err
+	}
+
+	s.logger.Infow("dead letters purged", "bot_id", botID)
+	return nil
+}
+
+func (s *Service) liveDeadLetters(ctx context.Context, botID string, limit int) ([]*models.DLQEntry, error) {
+	start, handled, err := s.dlqState(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handled entries are skipped, read enough to still fill the page
+	records, err := s.kafkaAdmin.ReadRecords(ctx, botID, dlqTopic, start, min(limit+len(handled), maxDLQRead))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*models.DLQEntry, 0, min(limit, len(records)))
+	for _, record := range records {
+		entry, err := dlqEntry(record)
+		if err != nil {
+			s.logger.Errorw("invalid dead letter", "bot_id", botID, "offset", record.Offset, "error", err)
+			continue
+		}
+		if handled[entry.ID] {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) == limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// deadLetter reads a live entry by id
+func (s *Service) deadLetter(ctx context.Context, botID, entryID string) (*models.DLQEntry, *kafka.Record, error) {
+	partition, offset, err := parseEntryID(entryID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start, handled, err := s.dlqState(ctx, botID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if handled[entryID] || offset < start[partition] {
+		return nil, nil, fmt.Errorf("dlq entry not found")
+	}
+
+	record, err := s.kafkaAdmin.ReadRecord(ctx, botID, dlqTopic, partition, offset)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dlq entry not found: %w", err)
+	}
+
+	entry, err := dlqEntry(*record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, record, nil
+}
+
+func (s *Service) dlqState(ctx context.Context, botID string) (map[int]int64, map[string]bool, error) {
+	start, err := s.storage.DLQStart(ctx, botID)
+	if err != nil {
+		return nil, nil, err
+	}
+	handled, err := s.storage.DLQHandled(ctx, botID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return start, handled, nil
+}
+
+// replay republishes the dead-lettered command; the gateway sends it with the bot's current token
+func (s *Service) replay(ctx context.Context, botConfig *models.BotConfig, entry *models.DLQEntry, key []byte) error {
+	if err := s.kafkaAdmin.Publish(ctx, botConfig.BotID, "outgoing", key, entry.Command); err != nil {
+		return err
+	}
+
+	return s.storage.MarkDLQHandled(ctx, botConfig.BotID, entry.ID)
+}
+
+func dlqEntry(record kafka.Record) (*models.DLQEntry, error) {
+	entry := &models.DLQEntry{ID: fmt.Sprintf("%d-%d", record.Partition, record.Offset)}
+	if err := json.Unmarshal(record.Value, &entry.DeadLetter); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+	}
+	return entry, nil
+}
+
+// parseEntryID splits <partition>-<offset>
+func parseEntryID(entryID string) (int, int64, error) {
+	p, o, ok := strings.Cut(entryID, "-")
+	partition, err1 := strconv.Atoi(p)
+	offset, err2 := strconv.ParseInt(o, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("%w: malformed entry id %q", ErrInvalidRequest, entryID)
+	}
+	return partition, offset, nil
+}
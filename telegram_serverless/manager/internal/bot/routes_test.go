@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+)
+
+func TestValidateRoutesTopics(t *testing.T) {
+	tests := []struct {
+		topic string
+		valid bool
+	}{
+		{"commands", true},
+		{"outgoing_photos", true},
+		{"incoming", false},
+		{"outgoing", false},
+		{"dlq", false},
+		{"results", false},
+		{"x_incoming", false},
+		{"x_outgoing", false},
+		{"x_dlq", false},
+		{"x_results", false},
+		{"Commands", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		routes := []models.RoutingRule{{Topic: tt.topic, UpdateTypes: []string{"message"}}}
+		err := validateRoutes(routes)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateRoutes(topic %q) error = %v, want valid = %v", tt.topic, err, tt.valid)
+		}
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
@@ -16,6 +20,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// ErrInvalidRequest marks errors caused by the request rather than by the platform
+var ErrInvalidRequest = errors.New("invalid request")
+
 type Service struct {
 	storage         *storage.RedisStorage
 	kafkaAdmin      *kafka.Admin
@@ -53,20 +60,45 @@ func (s *Service) CreateBot(ctx context.Context, req *models.CreateBotRequest) (
 	botID := s.generateBotID()
 
 	if err := s.validateCreateRequest(req); err != nil {
-		return nil, fmt.Errorf("invalid request: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	var webhookOptions *models.WebhookOptions
+	dropPendingUpdates := false
+	if req.WebhookOptions != nil {
+		webhookOptions = &req.WebhookOptions.WebhookOptions
+		dropPendingUpdates = req.WebhookOptions.DropPendingUpdates
+	}
+
+	// Without a public https url Telegram can't deliver webhooks, so poll instead
+	if req.IngestionMode == "" && !s.webhooksEnabled() {
+		req.IngestionMode = models.IngestionPolling
+	}
+
+	// Pin the bot to the current default so changing it later never moves bots silently
+	telegramAPIURL := strings.TrimSuffix(req.TelegramAPIURL, "/")
+	if telegramAPIURL == "" {
+		telegramAPIURL = s.tgClient.BaseURL()
 	}
 
 	botConfig := &models.BotConfig{
-		BotID:       botID,
-		BotToken:    req.BotToken,
-		BotName:     req.BotName,
-		WorkerImage: req.WorkerImage,
-		MinReplicas: req.MinReplicas,
-		MaxReplicas: req.MaxReplicas,
-		EnvVars:     req.EnvVars,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-		Status:      "creating",
+		BotID:             botID,
+		BotToken:          req.BotToken,
+		BotName:           req.BotName,
+		WorkerImage:       req.WorkerImage,
+		MinReplicas:       req.MinReplicas,
+		MaxReplicas:       req.MaxReplicas,
+		EnvVars:           req.EnvVars,
+		TelegramAPIURL:    telegramAPIURL,
+		WebhookID:         randomHex(16),
+		WebhookSecret:     randomHex(32),
+		WebhookOptions:    webhookOptions,
+		PartitionStrategy: req.PartitionStrategy,
+		DeliveryMode:      req.DeliveryMode,
+		IngestionMode:     req.IngestionMode,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+		Status:            "creating",
 	}
 
 	if err := s.storage.SaveBot(ctx, botConfig); err != nil {
@@ -92,36 +124,43 @@ func (s *Service) CreateBot(ctx context.Context, req *models.CreateBotRequest) (
 		return nil, fmt.Errorf("failed to create scaledobject: %w", err)
 	}
 
-	webhookURL := fmt.Sprintf("%s/webhook/%s", s.gatewayURL, req.BotToken)
-	s.logger.Infow("setting telegram webhook", "bot_id", botID, "webhook_url", webhookURL)
-	if strings.HasPrefix(s.gatewayURL, "https://") {
-		var caCert []byte
-		var err error
-		if s.tlsCaSecretName != "" {
-			caCert, err = s.k8sClient.GetSecret(ctx, s.tlsCaSecretName)
-			if err != nil {
-				s.logger.Errorw("failed to get ca certificate from secret", "error", err, "secret_name", s.tlsCaSecretName)
-				// Можно продолжить без сертификата, но лучше залогировать ошибку
-			}
+	if telegramAPIURL != telegram.CloudAPIURL {
+		// A bot has to be logged out of the cloud Bot API before a local server can serve it
+		s.logger.Infow("logging bot out of the cloud bot api", "bot_id", botID, "telegram_api_url", telegramAPIURL)
+		if err := s.tgClient.WithBaseURL(telegram.CloudAPIURL).LogOut(ctx, req.BotToken); err != nil {
+			s.logger.Warnw("failed to log out of the cloud bot api", "bot_id", botID, "error", err)
 		}
+	}
 
-		if err := s.tgClient.SetWebhook(req.BotToken, webhookURL, caCert); err != nil {
-			s.logger.Errorw("failed to set webhook", "error", err)
+	webhookURL := s.webhookURL(botConfig)
+	if s.usesWebhook(botConfig) {
+		s.logger.Infow("setting telegram webhook", "bot_id", botID, "webhook_url", webhookURL)
+		if err := s.registerWebhook(ctx, botConfig, dropPendingUpdates); err != nil {
+			s.logger.Errorw("failed to set webhook, webhook monitor will retry", "bot_id", botID, "error", err)
 		}
 	} else {
-		s.logger.Warnw("gateway_url is not a public https url, skipping setting webhook. Use this url for local testing", "webhook_url", webhookURL)
+		// getUpdates is refused while a webhook is set
+		s.logger.Infow("bot uses polling, deleting telegram webhook", "bot_id", botID)
+		if err := s.tgClientFor(botConfig).DeleteWebhook(ctx, botConfig.BotToken); err != nil {
+			s.logger.Errorw("failed to delete webhook", "bot_id", botID, "error", err)
+		}
+		webhookURL = ""
 	}
 
 	if err := s.updateBotStatus(ctx, botID, "running"); err != nil {
 		s.logger.Errorw("failed to update bot status", "error", err)
 	}
 
+	s.publishEvent(ctx, models.BotEventCreated, botID)
+
 	response := &models.CreateBotResponse{
 		BotID:  botID,
 		Status: "created",
 		KafkaTopics: models.KafkaTopics{
 			Incoming: fmt.Sprintf("bot_%s_incoming", botID),
 			Outgoing: fmt.Sprintf("bot_%s_outgoing", botID),
+			DLQ:      kafka.BotTopic(botID, "dlq"),
+			Results:  kafka.BotTopic(botID, "results"),
 		},
 		WebhookURL: webhookURL,
 	}
@@ -139,7 +178,7 @@ func (s *Service) DeleteBot(ctx context.Context, botID string) error {
 	s.updateBotStatus(ctx, botID, "deleting")
 
 	s.logger.Infow("deleting telegram webhook", "bot_id", botID)
-	if err := s.tgClient.DeleteWebhook(botConfig.BotToken); err != nil {
+	if err := s.tgClientFor(botConfig).DeleteWebhook(ctx, botConfig.BotToken); err != nil {
 		s.logger.Errorw("failed to delete webhook", "error", err)
 	}
 
@@ -158,10 +197,16 @@ func (s *Service) DeleteBot(ctx context.Context, botID string) error {
 		s.logger.Errorw("failed to delete kafka topics", "error", err)
 	}
 
-	if err := s.storage.DeleteBot(ctx, botID, botConfig.BotToken); err != nil {
+	if err := s.storage.DeleteBotBroadcasts(ctx, botID); err != nil {
+		s.logger.Errorw("failed to delete broadcasts", "error", err)
+	}
+
+	if err := s.storage.DeleteBot(ctx, botConfig); err != nil {
 		return fmt.Errorf("failed to delete bot from storage: %w", err)
 	}
 
+	s.publishEvent(ctx, models.BotEventDeleted, botID)
+
 	s.logger.Infow("bot deleted successfully", "bot_id", botID)
 	return nil
 }
@@ -189,9 +234,23 @@ func (s *Service) GetBot(ctx context.Context, botID string) (*models.BotStatusRe
 			Min:     botConfig.MinReplicas,
 			Max:     botConfig.MaxReplicas,
 		},
-		KafkaLag:  0, // TODO: Добавить KafkaLag
-		CreatedAt: botConfig.CreatedAt,
+		KafkaLag:            0, // TODO: Добавить KafkaLag
+		TelegramAPIURL:      s.tgClientFor(botConfig).BaseURL(),
+		WebhookOptions:      botConfig.WebhookOptions,
+		PartitionStrategy:   partitionStrategy(botConfig),
+		DeliveryMode:        botConfig.DeliveryMode,
+		IngestionMode:       ingestionMode(botConfig),
+		InlineReplies:       botConfig.InlineReplies,
+		InlineReplyBudget:   botConfig.InlineReplyBudget,
+		OutgoingConcurrency: botConfig.OutgoingConcurrency,
+		CreatedAt:           botConfig.CreatedAt,
+	}
+
+	webhookStatus, err := s.storage.GetWebhookStatus(ctx, botID)
+	if err != nil {
+		s.logger.Errorw("failed to get webhook status", "bot_id", botID, "error", err)
 	}
+	response.Webhook = webhookStatus
 
 	return response, nil
 }
@@ -223,6 +282,288 @@ func (s *Service) UpdateReplicas(ctx context.Context, botID string, req *models.
 	return nil
 }
 
+// UpdateWebhookOptions changes the setWebhook options of a bot and re-registers its webhook
+func (s *Service) UpdateWebhookOptions(ctx context.Context, botID string, req *models.UpdateWebhookOptionsRequest) error {
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return err
+	}
+
+	opts := models.WebhookOptions{}
+	if botConfig.WebhookOptions != nil {
+		opts = *botConfig.WebhookOptions
+	}
+
+	if req.AllowedUpdates != nil {
+		opts.AllowedUpdates = *req.AllowedUpdates
+	}
+	if req.MaxConnections != nil {
+		opts.MaxConnections = *req.MaxConnections
+	}
+	if req.IPAddress != nil {
+		opts.IPAddress = *req.IPAddress
+	}
+
+	if err := validateWebhookOptions(&opts); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	botConfig.WebhookOptions = &opts
+	botConfig.UpdatedAt = time.Now()
+
+	if err := s.storage.SaveBot(ctx, botConfig); err != nil {
+		return fmt.Errorf("failed to save bot config: %w", err)
+	}
+
+	s.publishEvent(ctx, models.BotEventUpdated, botID)
+
+	if s.usesWebhook(botConfig) {
+		dropPendingUpdates := req.DropPendingUpdates != nil && *req.DropPendingUpdates
+		if err := s.registerWebhook(ctx, botConfig, dropPendingUpdates); err != nil {
+			return fmt.Errorf("failed to set webhook: %w", err)
+		}
+	}
+
+	s.logger.Infow("webhook options updated", "bot_id", botID)
+	return nil
+}
+
+// UpdateSettings changes the platform-side settings of a bot.
+// Gateways pick them up through the bot event, no restart is needed.
+func (s *Service) UpdateSettings(ctx context.Context, botID string, req *models.UpdateSettingsRequest) error {
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return err
+	}
+
+	if req.PartitionStrategy != nil {
+		if err := validatePartitionStrategy(*req.PartitionStrategy); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+		}
+		botConfig.PartitionStrategy = *req.PartitionStrategy
+	}
+	if req.DeliveryMode != nil {
+		if err := validateDeliveryMode(*req.DeliveryMode); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+		}
+		botConfig.DeliveryMode = *req.DeliveryMode
+	}
+
+	if req.InlineReplies != nil {
+		botConfig.InlineReplies = *req.InlineReplies
+	}
+	if req.InlineReplyBudget != nil {
+		// Telegram gives up on a webhook after a few seconds
+		if *req.InlineReplyBudget < 0 || *req.InlineReplyBudget > 5000 {
+			return fmt.Errorf("%w: inline_reply_budget_ms must be between 0 and 5000", ErrInvalidRequest)
+		}
+		botConfig.InlineReplyBudget = *req.InlineReplyBudget
+	}
+	if req.OutgoingConcurrency != nil {
+		if *req.OutgoingConcurrency < 0 || *req.OutgoingConcurrency > 100 {
+			return fmt.Errorf("%w: outgoing_concurrency must be between 0 and 100", ErrInvalidRequest)
+		}
+		botConfig.OutgoingConcurrency = *req.OutgoingConcurrency
+	}
+
+	modeChanged := false
+	if req.IngestionMode != nil && *req.IngestionMode != ingestionMode(botConfig) {
+		if err := s.validateIngestionMode(*req.IngestionMode); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+		}
+		botConfig.IngestionMode = *req.IngestionMode
+		modeChanged = true
+	}
+
+	botConfig.UpdatedAt = time.Now()
+
+	if err := s.storage.SaveBot(ctx, botConfig); err != nil {
+		return fmt.Errorf("failed to save bot config: %w", err)
+	}
+
+	// Drop the webhook before gateways start polling, getUpdates is refused while it is set
+	if modeChanged {
+		if s.usesWebhook(botConfig) {
+			if err := s.registerWebhook(ctx, botConfig, false); err != nil {
+				return fmt.Errorf("failed to set webhook: %w", err)
+			}
+		} else if err := s.tgClientFor(botConfig).DeleteWebhook(ctx, botConfig.BotToken); err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+	}
+
+	s.publishEvent(ctx, models.BotEventUpdated, botID)
+
+	s.logger.Infow("bot settings updated", "bot_id", botID)
+	return nil
+}
+
+// reservedTopics are topic names the platform itself uses for every bot. Rule topics
+// may not end in them either: the gateway recognizes bot_<id>_outgoing by its suffix.
+var reservedTopics = []string{"incoming", "outgoing", "dlq", "results"}
+
+func isReservedTopic(topic string) bool {
+	for _, reserved := range reservedTopics {
+		if topic == reserved || strings.HasSuffix(topic, "_"+reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+var topicNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// GetRoutes returns the routing rules of a bot and the topics they publish to
+func (s *Service) GetRoutes(ctx context.Context, botID string) (*models.RoutesResponse, error) {
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	return routesResponse(botConfig), nil
+}
+
+// UpdateRoutes replaces the routing rules of a bot.
+// Topics are created before the rules are saved, so the gateway never routes to a missing topic.
+// Topics of removed rules are kept until the bot is deleted, so workers can drain them.
+func (s *Service) UpdateRoutes(ctx context.Context, botID string, req *models.UpdateRoutesRequest) (*models.RoutesResponse, error) {
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRoutes(req.Routes); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	names := routeTopicNames(req.Routes)
+	if err := s.kafkaAdmin.CreateRouteTopics(ctx, botID, names); err != nil {
+		return nil, fmt.Errorf("failed to create route topics: %w", err)
+	}
+
+	botConfig.Routes = req.Routes
+	botConfig.UpdatedAt = time.Now()
+
+	if err := s.storage.SaveBot(ctx, botConfig); err != nil {
+		return nil, fmt.Errorf("failed to save bot config: %w", err)
+	}
+
+	s.publishEvent(ctx, models.BotEventUpdated, botID)
+
+	// Tell the worker, and the tg_proxy sidecar serving its getUpdates, which topics to
+	// consume besides the incoming one; changing the env restarts the pods
+	topics := make([]string, 0, len(names))
+	for _, name := range names {
+		topics = append(topics, kafka.BotTopic(botID, name))
+	}
+	if err := s.k8sClient.UpdateBotEnv(ctx, botID, "ROUTE_TOPICS", strings.Join(topics, ",")); err != nil {
+		return nil, fmt.Errorf("failed to update deployment: %w", err)
+	}
+
+	s.logger.Infow("bot routes updated", "bot_id", botID, "routes", len(req.Routes))
+	return routesResponse(botConfig), nil
+}
+
+// UpdateTelegramAPI moves a bot to another Bot API server
+func (s *Service) UpdateTelegramAPI(ctx context.Context, botID string, req *models.UpdateTelegramAPIRequest) error {
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return err
+	}
+
+	newURL := strings.TrimSuffix(req.TelegramAPIURL, "/")
+	if newURL == "" {
+		newURL = s.tgClient.BaseURL()
+	}
+	if err := validateAPIURL(newURL); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	oldClient := s.tgClientFor(botConfig)
+	oldURL := oldClient.BaseURL()
+	if oldURL == newURL {
+		return nil
+	}
+
+	s.logger.Infow("migrating bot to another bot api server", "bot_id", botID, "from", oldURL, "to", newURL)
+
+	if err := oldClient.DeleteWebhook(ctx, botConfig.BotToken); err != nil {
+		s.logger.Warnw("failed to delete webhook on previous bot api server", "bot_id", botID, "error", err)
+	}
+
+	// The bot has to leave its current server before another one may serve it
+	if oldURL == telegram.CloudAPIURL {
+		err = oldClient.LogOut(ctx, botConfig.BotToken)
+	} else {
+		err = oldClient.Close(ctx, botConfig.BotToken)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release bot from %s: %w", oldURL, err)
+	}
+
+	botConfig.TelegramAPIURL = newURL
+	botConfig.UpdatedAt = time.Now()
+
+	if err := s.storage.SaveBot(ctx, botConfig); err != nil {
+		return fmt.Errorf("failed to save bot config: %w", err)
+	}
+
+	s.publishEvent(ctx, models.BotEventUpdated, botID)
+
+	if err := s.k8sClient.UpdateBotEnv(ctx, botID, "TELEGRAM_API_URL", newURL); err != nil {
+		return fmt.Errorf("failed to update worker env: %w", err)
+	}
+
+	if s.usesWebhook(botConfig) {
+		if err := s.registerWebhook(ctx, botConfig, false); err != nil {
+			s.logger.Errorw("failed to set webhook, webhook monitor will retry", "bot_id", botID, "error", err)
+		}
+	}
+
+	s.logger.Infow("bot migrated to another bot api server", "bot_id", botID, "telegram_api_url", newURL)
+	return nil
+}
+
+// RotateToken switches a bot to a new token, e.g. after it was revoked in BotFather
+func (s *Service) RotateToken(ctx context.Context, botID string, req *models.RotateTokenRequest) error {
+	if req.BotToken == "" {
+		return fmt.Errorf("%w: bot_token is required", ErrInvalidRequest)
+	}
+
+	botConfig, err := s.storage.GetBot(ctx, botID)
+	if err != nil {
+		return err
+	}
+
+	oldToken := botConfig.BotToken
+	if oldToken == req.BotToken {
+		return nil
+	}
+
+	botConfig.BotToken = req.BotToken
+	botConfig.UpdatedAt = time.Now()
+
+	if err := s.storage.RotateToken(ctx, botConfig, oldToken); err != nil {
+		return fmt.Errorf("failed to save bot config: %w", err)
+	}
+
+	s.publishEvent(ctx, models.BotEventTokenRotated, botID)
+
+	// Only the sidecar holds the token, it needs it to download files
+	if err := s.k8sClient.UpdateSidecarEnv(ctx, botID, "BOT_TOKEN", req.BotToken); err != nil {
+		return fmt.Errorf("failed to update sidecar env: %w", err)
+	}
+
+	if s.usesWebhook(botConfig) {
+		if err := s.registerWebhook(ctx, botConfig, false); err != nil {
+			s.logger.Errorw("failed to set webhook, webhook monitor will retry", "bot_id", botID, "error", err)
+		}
+	}
+
+	s.logger.Infow("bot token rotated", "bot_id", botID)
+	return nil
+}
+
 func (s *Service) ListBots(ctx context.Context) ([]*models.BotStatusResponse, error) {
 	botIDs, err := s.storage.ListBots(ctx)
 	if err != nil {
@@ -242,10 +583,125 @@ func (s *Service) ListBots(ctx context.Context) ([]*models.BotStatusResponse, er
 	return bots, nil
 }
 
+// EnsureTopics creates the topics every bot needs, along with its route topics, for
+// bots created before a topic was added (e.g. _dlq and _results). Existing topics are
+// left alone, so it runs on every start.
+func (s *Service) EnsureTopics(ctx context.Context) error {
+	botIDs, err := s.storage.ListBots(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list bots: %w", err)
+	}
+
+	for _, botID := range botIDs {
+		if err := s.kafkaAdmin.CreateTopics(ctx, botID); err != nil {
+			s.logger.Errorw("failed to ensure kafka topics", "bot_id", botID, "error", err)
+			continue
+		}
+
+		botConfig, err := s.storage.GetBot(ctx, botID)
+		if err != nil {
+			s.logger.Errorw("failed to get bot for route topics", "bot_id", botID, "error", err)
+			continue
+		}
+		if names := routeTopicNames(botConfig.Routes); len(names) > 0 {
+			if err := s.kafkaAdmin.CreateRouteTopics(ctx, botID, names); err != nil {
+				s.logger.Errorw("failed to ensure route topics", "bot_id", botID, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// StreamLogs opens a merged log stream for all replicas of a bot
+func (s *Service) StreamLogs(ctx context.Context, botID string, opts kubernetes.LogOptions) (<-chan kubernetes.LogLine, error) {
+	if _, err := s.storage.GetBot(ctx, botID); err != nil {
+		return nil, err
+	}
+
+	return s.k8sClient.StreamBotLogs(ctx, botID, opts)
+}
+
+// webhookURL returns the gateway URL Telegram should deliver the bot's updates to.
+// The path is an opaque per-bot ID so the token never shows up in URLs.
+func (s *Service) webhookURL(botConfig *models.BotConfig) string {
+	return fmt.Sprintf("%s/hooks/%s", s.gatewayURL, botConfig.WebhookID)
+}
+
+// ensureWebhookIdentity assigns a webhook ID and secret to bots created before
+// opaque webhook paths existed, so the monitor can move them off the token path
+func (s *Service) ensureWebhookIdentity(ctx context.Context, botConfig *models.BotConfig) error {
+	if botConfig.WebhookID != "" && botConfig.WebhookSecret != "" {
+		return nil
+	}
+
+	// Assigned in storage so a concurrent update of the bot neither loses the identity
+	// nor gets overwritten by a stale copy of the config
+	stored, err := s.storage.AssignWebhookIdentity(ctx, botConfig.BotID, randomHex(16), randomHex(32))
+	if err != nil {
+		return fmt.Errorf("failed to save webhook identity: %w", err)
+	}
+	botConfig.WebhookID = stored.WebhookID
+	botConfig.WebhookSecret = stored.WebhookSecret
+
+	s.publishEvent(ctx, models.BotEventUpdated, botConfig.BotID)
+
+	s.logger.Infow("assigned webhook id to bot", "bot_id", botConfig.BotID)
+	return nil
+}
+
+// webhooksEnabled reports whether Telegram can reach the gateway at all
+func (s *Service) webhooksEnabled() bool {
+	return strings.HasPrefix(s.gatewayURL, "https://")
+}
+
+// usesWebhook reports whether Telegram should push the bot's updates to the gateway
+func (s *Service) usesWebhook(botConfig *models.BotConfig) bool {
+	return s.webhooksEnabled() && botConfig.IngestionMode != models.IngestionPolling
+}
+
+// registerWebhook points the bot's Telegram webhook at the gateway. dropPendingUpdates
+// discards the updates Telegram queued so far; it is never implied by stored options,
+// or every re-registration would lose updates.
+func (s *Service) registerWebhook(ctx context.Context, botConfig *models.BotConfig, dropPendingUpdates bool) error {
+	var caCert []byte
+	if s.tlsCaSecretName != "" {
+		var err error
+		caCert, err = s.k8sClient.GetSecret(ctx, s.tlsCaSecretName)
+		if err != nil {
+			s.logger.Errorw("failed to get ca certificate from secret", "error", err, "secret_name", s.tlsCaSecretName)
+			// Можно продолжить без сертификата, но лучше залогировать ошибку
+		}
+	}
+
+	params := telegram.SetWebhookParams{
+		URL:                s.webhookURL(botConfig),
+		SecretToken:        botConfig.WebhookSecret,
+		Certificate:        caCert,
+		DropPendingUpdates: dropPendingUpdates,
+	}
+	if opts := botConfig.WebhookOptions; opts != nil {
+		params.AllowedUpdates = opts.AllowedUpdates
+		params.MaxConnections = opts.MaxConnections
+		params.IPAddress = opts.IPAddress
+	}
+
+	return s.tgClientFor(botConfig).SetWebhook(ctx, botConfig.BotToken, params)
+}
+
+// tgClientFor returns a client for the Bot API server that serves the bot
+func (s *Service) tgClientFor(botConfig *models.BotConfig) *telegram.Client {
+	return s.tgClient.WithBaseURL(botConfig.TelegramAPIURL)
+}
+
 func (s *Service) generateBotID() string {
-	b := make([]byte, 8)
+	return "bot_" + randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
 	rand.Read(b)
-	return "bot_" + hex.EncodeToString(b)
+	return hex.EncodeToString(b)
 }
 
 func (s *Service) validateCreateRequest(req *models.CreateBotRequest) error {
@@ -267,9 +723,152 @@ func (s *Service) validateCreateRequest(req *models.CreateBotRequest) error {
 	if req.MinReplicas > req.MaxReplicas {
 		return fmt.Errorf("min_replicas must be <= max_replicas")
 	}
+	if req.TelegramAPIURL != "" {
+		if err := validateAPIURL(req.TelegramAPIURL); err != nil {
+			return err
+		}
+	}
+	if req.WebhookOptions != nil {
+		if err := validateWebhookOptions(&req.WebhookOptions.WebhookOptions); err != nil {
+			return err
+		}
+	}
+	if err := validatePartitionStrategy(req.PartitionStrategy); err != nil {
+		return err
+	}
+	if err := validateDeliveryMode(req.DeliveryMode); err != nil {
+		return err
+	}
+	if err := s.validateIngestionMode(req.IngestionMode); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (s *Service) validateIngestionMode(mode string) error {
+	switch mode {
+	case "", models.IngestionPolling:
+		return nil
+	case models.IngestionWebhook:
+		if !s.webhooksEnabled() {
+			return fmt.Errorf("ingestion_mode webhook requires a public https gateway_url")
+		}
+		return nil
+	}
+	return fmt.Errorf("ingestion_mode must be %s or %s", models.IngestionWebhook, models.IngestionPolling)
+}
+
+func ingestionMode(botConfig *models.BotConfig) string {
+	if botConfig.IngestionMode == "" {
+		return models.IngestionWebhook
+	}
+	return botConfig.IngestionMode
+}
+
+func validateRoutes(routes []models.RoutingRule) error {
+	for i, rule := range routes {
+		if !topicNamePattern.MatchString(rule.Topic) {
+			return fmt.Errorf("routes[%d]: topic must be 1-32 characters of a-z, 0-9 and _", i)
+		}
+		if isReservedTopic(rule.Topic) {
+			return fmt.Errorf("routes[%d]: topic %q is reserved", i, rule.Topic)
+		}
+		if len(rule.UpdateTypes) == 0 && rule.CommandPrefix == "" && len(rule.ChatTypes) == 0 && rule.TextPattern == "" {
+			return fmt.Errorf("routes[%d]: at least one condition is required", i)
+		}
+		if rule.CommandPrefix != "" && !strings.HasPrefix(rule.CommandPrefix, "/") {
+			return fmt.Errorf("routes[%d]: command_prefix must start with /", i)
+		}
+		if rule.TextPattern != "" {
+			if _, err := regexp.Compile(rule.TextPattern); err != nil {
+				return fmt.Errorf("routes[%d]: invalid text_pattern: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func routeTopicNames(routes []models.RoutingRule) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, rule := range routes {
+		if !seen[rule.Topic] {
+			seen[rule.Topic] = true
+			names = append(names, rule.Topic)
+		}
+	}
+	return names
+}
+
+func routesResponse(botConfig *models.BotConfig) *models.RoutesResponse {
+	response := &models.RoutesResponse{
+		Routes: botConfig.Routes,
+		Topics: make(map[string]string),
+	}
+	if response.Routes == nil {
+		response.Routes = []models.RoutingRule{}
+	}
+	for _, name := range routeTopicNames(botConfig.Routes) {
+		response.Topics[name] = kafka.BotTopic(botConfig.BotID, name)
+	}
+	return response
+}
+
+func validateDeliveryMode(mode string) error {
+	switch mode {
+	case "", models.DeliveryAsync, models.DeliveryDurable:
+		return nil
+	}
+	return fmt.Errorf("delivery_mode must be %s or %s", models.DeliveryAsync, models.DeliveryDurable)
+}
+
+func validatePartitionStrategy(strategy string) error {
+	switch strategy {
+	case "", models.PartitionByChat, models.PartitionByUser, models.PartitionRoundRobin:
+		return nil
+	}
+	return fmt.Errorf("partition_strategy must be one of %s, %s, %s",
+		models.PartitionByChat, models.PartitionByUser, models.PartitionRoundRobin)
+}
+
+func partitionStrategy(botConfig *models.BotConfig) string {
+	if botConfig.PartitionStrategy == "" {
+		return models.PartitionByChat
+	}
+	return botConfig.PartitionStrategy
+}
+
+func validateWebhookOptions(opts *models.WebhookOptions) error {
+	if opts.MaxConnections < 0 || opts.MaxConnections > 100 {
+		return fmt.Errorf("max_connections must be between 0 (telegram's default) and 100")
+	}
+	if opts.IPAddress != "" && net.ParseIP(opts.IPAddress) == nil {
+		return fmt.Errorf("ip_address must be a valid ip address")
+	}
+	return nil
+}
+
+func validateAPIURL(apiURL string) error {
+	u, err := url.Parse(apiURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("telegram_api_url must be an absolute http(s) url")
+	}
+	return nil
+}
+
+// publishEvent tells gateway replicas to drop their cached view of the bot
+func (s *Service) publishEvent(ctx context.Context, eventType, botID string) {
+	event := &models.BotEvent{
+		Type:      eventType,
+		BotID:     botID,
+		Timestamp: time.Now(),
+	}
+
+	if err := s.storage.PublishBotEvent(ctx, event); err != nil {
+		s.logger.Errorw("failed to publish bot event", "bot_id", botID, "type", eventType, "error", err)
+	}
+}
+
 func (s *Service) updateBotStatus(ctx context.Context, botID, status string) error {
 	return s.storage.UpdateBotStatus(ctx, botID, status)
 }
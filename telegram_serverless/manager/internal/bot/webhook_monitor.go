@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	webhookRetryBaseDelay = 30 * time.Second
+	webhookRetryMaxDelay  = 30 * time.Minute
+)
+
+// WebhookMonitor periodically checks every bot's webhook through getWebhookInfo
+// and re-registers webhooks that Telegram dropped or that point elsewhere
+type WebhookMonitor struct {
+	service  *Service
+	interval time.Duration
+	logger   *zap.SugaredLogger
+
+	mu      sync.Mutex
+	retries map[string]*webhookRetry
+}
+
+type webhookRetry struct {
+	failures    int
+	nextAttempt time.Time
+}
+
+func NewWebhookMonitor(service *Service, interval time.Duration, logger *zap.SugaredLogger) *WebhookMonitor {
+	return &WebhookMonitor{
+		service:  service,
+		interval: interval,
+		logger:   logger,
+		retries:  make(map[string]*webhookRetry),
+	}
+}
+
+// Start runs the monitor until ctx is cancelled
+func (m *WebhookMonitor) Start(ctx context.Context) {
+	if !m.service.webhooksEnabled() {
+		m.logger.Warnw("gateway_url is not a public https url, webhook monitor disabled")
+		return
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *WebhookMonitor) checkAll(ctx context.Context) {
+	botIDs, err := m.service.storage.ListBots(ctx)
+	if err != nil {
+		m.logger.Errorw("failed to list bots for webhook check", "error", err)
+		return
+	}
+
+	active := make(map[string]bool, len(botIDs))
+	for _, botID := range botIDs {
+		active[botID] = true
+
+		botConfig, err := m.service.storage.GetBot(ctx, botID)
+		if err != nil {
+			m.logger.Errorw("failed to get bot for webhook check", "bot_id", botID, "error", err)
+			continue
+		}
+
+		if botConfig.Status != "running" || !m.service.usesWebhook(botConfig) {
+			continue
+		}
+
+		m.checkBot(ctx, botConfig)
+	}
+
+	m.mu.Lock()
+	for botID := range m.retries {
+		if !active[botID] {
+			delete(m.retries, botID)
+		}
+	}
+	m.mu.Unlock()
+}
+
+func (m *WebhookMonitor) checkBot(ctx context.Context, botConfig *models.BotConfig) {
+	botID := botConfig.BotID
+
+	if err := m.service.ensureWebhookIdentity(ctx, botConfig); err != nil {
+		m.logger.Errorw("failed to ensure webhook identity", "bot_id", botID, "error", err)
+		return
+	}
+
+	status, err := m.service.storage.GetWebhookStatus(ctx, botID)
+	if err != nil {
+		m.logger.Errorw("failed to get webhook status", "bot_id", botID, "error", err)
+	}
+	if status == nil {
+		status = &models.WebhookStatus{}
+	}
+
+	info, err := m.service.tgClientFor(botConfig).GetWebhookInfo(ctx, botConfig.BotToken)
+	if err != nil {
+		m.logger.Errorw("failed to get webhook info", "bot_id", botID, "error", err)
+		return
+	}
+
+	status.URL = info.URL
+	status.PendingUpdateCount = info.PendingUpdateCount
+	status.LastErrorMessage = info.LastErrorMessage
+	status.LastErrorDate = nil
+	if info.LastErrorDate > 0 {
+		lastErrorDate := time.Unix(info.LastErrorDate, 0).UTC()
+		status.LastErrorDate = &lastErrorDate
+	}
+	status.CheckedAt = time.Now()
+
+	expectedURL := m.service.webhookURL(botConfig)
+	if info.URL != expectedURL {
+		m.reregister(ctx, botConfig, info.URL, status)
+	}
+
+	if err := m.service.storage.SaveWebhookStatus(ctx, botID, status); err != nil {
+		m.logger.Errorw("failed to save webhook status", "bot_id", botID, "error", err)
+	}
+}
+
+// reregister runs setWebhook again, backing off exponentially after failures
+func (m *WebhookMonitor) reregister(ctx context.Context, botConfig *models.BotConfig, currentURL string, status *models.WebhookStatus) {
+	botID := botConfig.BotID
+
+	m.mu.Lock()
+	retry, ok := m.retries[botID]
+	if !ok {
+		retry = &webhookRetry{}
+		m.retries[botID] = retry
+	}
+	m.mu.Unlock()
+
+	if time.Now().Before(retry.nextAttempt) {
+		return
+	}
+
+	m.logger.Warnw("webhook url mismatch, re-registering",
+		"bot_id", botID,
+		"current_url", currentURL,
+		"attempt", retry.failures+1)
+
+	if err := m.service.registerWebhook(ctx, botConfig, false); err != nil {
+		retry.failures++
+		delay := webhookRetryBaseDelay << min(retry.failures-1, 10)
+		if delay > webhookRetryMaxDelay {
+			delay = webhookRetryMaxDelay
+		}
+		retry.nextAttempt = time.Now().Add(delay)
+
+		status.RegisterError = err.Error()
+		status.RegisterFailures = retry.failures
+		m.logger.Errorw("failed to re-register webhook",
+			"bot_id", botID,
+			"failures", retry.failures,
+			"next_attempt", retry.nextAttempt,
+			"error", err)
+		return
+	}
+
+	m.mu.Lock()
+	delete(m.retries, botID)
+	m.mu.Unlock()
+
+	registeredAt := time.Now()
+	status.URL = m.service.webhookURL(botConfig)
+	status.LastRegisteredAt = &registeredAt
+	status.RegisterError = ""
+	status.RegisterFailures = 0
+
+	m.logger.Infow("webhook re-registered", "bot_id", botID)
+}
@@ -4,21 +4,24 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	Port               string
-	KafkaBrokers       []string
-	RedisAddr          string
-	RedisPassword      string
-	RedisDB            int
-	GatewayURL         string
-	WorkerNamespace    string
-	MetricsPort        string
-	LogLevel           string
-	DefaultWorkerImage string
-	SidecarImage       string
-	TlsCaSecretName    string
+	Port                 string
+	KafkaBrokers         []string
+	RedisAddr            string
+	RedisPassword        string
+	RedisDB              int
+	GatewayURL           string
+	TelegramAPIURL       string
+	WorkerNamespace      string
+	MetricsPort          string
+	LogLevel             string
+	DefaultWorkerImage   string
+	SidecarImage         string
+	TlsCaSecretName      string
+	WebhookCheckInterval time.Duration
 }
 
 func Load() *Config {
@@ -26,19 +29,26 @@ func Load() *Config {
 
 	kafkaBrokers := strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ",")
 
+	webhookCheckInterval, err := time.ParseDuration(getEnv("WEBHOOK_CHECK_INTERVAL", "5m"))
+	if err != nil || webhookCheckInterval <= 0 {
+		webhookCheckInterval = 5 * time.Minute
+	}
+
 	return &Config{
-		Port:               getEnv("PORT", "8080"),
-		KafkaBrokers:       kafkaBrokers,
-		RedisAddr:          getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
-		RedisDB:            redisDB,
-		GatewayURL:         getEnv("GATEWAY_URL", "http://tg-gateway:8080"),
-		WorkerNamespace:    getEnv("WORKER_NAMESPACE", "default"),
-		MetricsPort:        getEnv("METRICS_PORT", "9090"),
-		LogLevel:           getEnv("LOG_LEVEL", "info"),
-		DefaultWorkerImage: getEnv("DEFAULT_WORKER_IMAGE", ""),
-		SidecarImage:       getEnv("SIDECAR_IMAGE", "your-registry/sidecar:latest"),
-		TlsCaSecretName:    getEnv("TLS_CA_SECRET_NAME", ""),
+		Port:                 getEnv("PORT", "8080"),
+		KafkaBrokers:         kafkaBrokers,
+		RedisAddr:            getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:        getEnv("REDIS_PASSWORD", ""),
+		RedisDB:              redisDB,
+		GatewayURL:           getEnv("GATEWAY_URL", "http://tg-gateway:8080"),
+		TelegramAPIURL:       getEnv("TELEGRAM_API_URL", "https://api.telegram.org"),
+		WorkerNamespace:      getEnv("WORKER_NAMESPACE", "default"),
+		MetricsPort:          getEnv("METRICS_PORT", "9090"),
+		LogLevel:             getEnv("LOG_LEVEL", "info"),
+		DefaultWorkerImage:   getEnv("DEFAULT_WORKER_IMAGE", ""),
+		SidecarImage:         getEnv("SIDECAR_IMAGE", "your-registry/sidecar:latest"),
+		TlsCaSecretName:      getEnv("TLS_CA_SECRET_NAME", ""),
+		WebhookCheckInterval: webhookCheckInterval,
 	}
 }
 
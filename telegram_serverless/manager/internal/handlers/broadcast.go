@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/uchebnick/telegram-serverless/broadcaststatus"
+	"github.com/uchebnick/telegram-serverless/manager/internal/bot"
+	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+	"github.com/uchebnick/telegram-serverless/manager/internal/storage"
+)
+
+// CreateBroadcast handles POST /bots/{bot_id}/broadcasts
+func (h *Handlers) CreateBroadcast(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	var req models.CreateBroadcastRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	broadcast, err := h.botService.CreateBroadcast(c.UserContext(), botID, &req)
+	switch {
+	case errors.Is(err, bot.ErrInvalidRequest):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, storage.ErrBotNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "bot not found"})
+	case err != nil:
+		h.logger.Errorw("failed to create broadcast", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(broadcast)
+}
+
+// ListBroadcasts handles GET /bots/{bot_id}/broadcasts
+func (h *Handlers) ListBroadcasts(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	broadcasts, err := h.botService.ListBroadcasts(c.UserContext(), botID)
+	if err != nil {
+		h.logger.Errorw("failed to list broadcasts", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list broadcasts"})
+	}
+
+	return c.JSON(broadcasts)
+}
+
+// GetBroadcast handles GET /broadcasts/{broadcast_id}
+func (h *Handlers) GetBroadcast(c *fiber.Ctx) error {
+	broadcastID := c.Params("broadcast_id")
+
+	broadcast, err := h.botService.GetBroadcast(c.UserContext(), broadcastID)
+	switch {
+	case errors.Is(err, broadcaststatus.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "broadcast not found"})
+	case err != nil:
+		h.logger.Errorw("failed to get broadcast", "broadcast_id", broadcastID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get broadcast"})
+	}
+
+	return c.JSON(broadcast)
+}
+
+// PauseBroadcast handles POST /broadcasts/{broadcast_id}/pause
+func (h *Handlers) PauseBroadcast(c *fiber.Ctx) error {
+	return h.changeBroadcast(c, "pause", h.botService.PauseBroadcast)
+}
+
+// ResumeBroadcast handles POST /broadcasts/{broadcast_id}/resume
+func (h *Handlers) ResumeBroadcast(c *fiber.Ctx) error {
+	return h.changeBroadcast(c, "resume", h.botService.ResumeBroadcast)
+}
+
+// CancelBroadcast handles POST /broadcasts/{broadcast_id}/cancel
+func (h *Handlers) CancelBroadcast(c *fiber.Ctx) error {
+	return h.changeBroadcast(c, "cancel", h.botService.CancelBroadcast)
+}
+
+func (h *Handlers) changeBroadcast(c *fiber.Ctx, action string, change func(ctx context.Context, broadcastID string) error) error {
+	broadcastID := c.Params("broadcast_id")
+
+	err := change(c.UserContext(), broadcastID)
+	switch {
+	case errors.Is(err, broadcaststatus.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "broadcast not found"})
+	case errors.Is(err, bot.ErrInvalidTransition):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		h.logger.Errorw("failed to "+action+" broadcast", "broadcast_id", broadcastID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to " + action + " broadcast"})
+	}
+
+	// The broadcast may have finished and expired in between
+	broadcast, err := h.botService.GetBroadcast(c.UserContext(), broadcastID)
+	switch {
+	case errors.Is(err, broadcaststatus.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "broadcast not found"})
+	case err != nil:
+		h.logger.Errorw("failed to get broadcast", "broadcast_id", broadcastID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get broadcast"})
+	}
+
+	return c.JSON(broadcast)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+)
+
+// ListDeadLetters handles GET /bots/{bot_id}/dlq
+func (h *Handlers) ListDeadLetters(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 1000"})
+	}
+
+	entries, err := h.botService.ListDeadLetters(c.UserContext(), botID, limit)
+	if err != nil {
+		h.logger.Errorw("failed to list dead letters", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(entries)
+}
+
+// GetDeadLetter handles GET /bots/{bot_id}/dlq/{entry_id}
+func (h *Handlers) GetDeadLetter(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+	entryID := c.Params("entry_id")
+
+	entry, err := h.botService.GetDeadLetter(c.UserContext(), botID, entryID)
+	if err != nil {
+		h.logger.Errorw("failed to get dead letter", "bot_id", botID, "entry_id", entryID, "error", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(entry)
+}
+
+// ReplayDeadLetter handles POST /bots/{bot_id}/dlq/{entry_id}/replay
+func (h *Handlers) ReplayDeadLetter(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+	entryID := c.Params("entry_id")
+
+	if err := h.botService.ReplayDeadLetter(c.UserContext(), botID, entryID); err != nil {
+		h.logger.Errorw("failed to replay dead letter", "bot_id", botID, "entry_id", entryID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "dead letter replayed"})
+}
+
+// ReplayDeadLetters handles POST /bots/{bot_id}/dlq/replay
+func (h *Handlers) ReplayDeadLetters(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	replayed, err := h.botService.ReplayDeadLetters(c.UserContext(), botID)
+	if err != nil {
+		h.logger.Errorw("failed to replay dead letters", "bot_id", botID, "replayed", replayed, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error(), "replayed": replayed})
+	}
+
+	return c.JSON(models.ReplayResponse{Replayed: replayed})
+}
+
+// DiscardDeadLetter handles DELETE /bots/{bot_id}/dlq/{entry_id}
+func (h *Handlers) DiscardDeadLetter(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+	entryID := c.Params("entry_id")
+
+	if err := h.botService.DiscardDeadLetter(c.UserContext(), botID, entryID); err != nil {
+		h.logger.Errorw("failed to discard dead letter", "bot_id", botID, "entry_id", entryID, "error", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "dead letter discarded"})
+}
+
+// PurgeDeadLetters handles DELETE /bots/{bot_id}/dlq
+func (h *Handlers) PurgeDeadLetters(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	if err := h.botService.PurgeDeadLetters(c.UserContext(), botID); err != nil {
+		h.logger.Errorw("failed to purge dead letters", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "dead letters purged"})
+}
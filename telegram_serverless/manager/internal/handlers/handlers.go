@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/uchebnick/telegram-serverless/manager/internal/bot"
+	"github.com/uchebnick/telegram-serverless/manager/internal/kubernetes"
 	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+	"github.com/uchebnick/telegram-serverless/manager/internal/storage"
 	"go.uber.org/zap"
 )
 
@@ -77,6 +86,105 @@ func (h *Handlers) UpdateReplicas(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "replicas updated"})
 }
 
+// UpdateWebhookOptions handles PATCH /bots/{bot_id}/webhook
+func (h *Handlers) UpdateWebhookOptions(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	var req models.UpdateWebhookOptionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if err := h.botService.UpdateWebhookOptions(c.UserContext(), botID, &req); err != nil {
+		h.logger.Errorw("failed to update webhook options", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "webhook options updated"})
+}
+
+// UpdateSettings handles PATCH /bots/{bot_id}/settings
+func (h *Handlers) UpdateSettings(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	var req models.UpdateSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if err := h.botService.UpdateSettings(c.UserContext(), botID, &req); err != nil {
+		h.logger.Errorw("failed to update settings", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "settings updated"})
+}
+
+// GetRoutes handles GET /bots/{bot_id}/routes
+func (h *Handlers) GetRoutes(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	response, err := h.botService.GetRoutes(c.UserContext(), botID)
+	if err != nil {
+		h.logger.Errorw("failed to get routes", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "bot not found"})
+	}
+
+	return c.JSON(response)
+}
+
+// UpdateRoutes handles PUT /bots/{bot_id}/routes
+func (h *Handlers) UpdateRoutes(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	var req models.UpdateRoutesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	response, err := h.botService.UpdateRoutes(c.UserContext(), botID, &req)
+	if err != nil {
+		h.logger.Errorw("failed to update routes", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(response)
+}
+
+// RotateToken handles PUT /bots/{bot_id}/token
+func (h *Handlers) RotateToken(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	var req models.RotateTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if err := h.botService.RotateToken(c.UserContext(), botID, &req); err != nil {
+		h.logger.Errorw("failed to rotate token", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "token rotated"})
+}
+
+// UpdateTelegramAPI handles PATCH /bots/{bot_id}/telegram-api
+func (h *Handlers) UpdateTelegramAPI(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	var req models.UpdateTelegramAPIRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if err := h.botService.UpdateTelegramAPI(c.UserContext(), botID, &req); err != nil {
+		h.logger.Errorw("failed to update telegram api", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "telegram api updated"})
+}
+
 // ListBots handles GET /bots
 func (h *Handlers) ListBots(c *fiber.Ctx) error {
 	bots, err := h.botService.ListBots(c.UserContext())
@@ -87,3 +195,98 @@ func (h *Handlers) ListBots(c *fiber.Ctx) error {
 
 	return c.JSON(bots)
 }
+
+// StreamLogs handles GET /bots/{bot_id}/logs
+// Merges the logs of all bot replicas and streams them as chunked text or SSE.
+func (h *Handlers) StreamLogs(c *fiber.Ctx) error {
+	botID := c.Params("bot_id")
+
+	opts := kubernetes.LogOptions{
+		Container: c.Query("container", "bot"),
+		Pod:       c.Query("pod"),
+		Follow:    c.QueryBool("follow", false),
+	}
+
+	if opts.Container != "bot" && opts.Container != "sidecar" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "container must be bot or sidecar"})
+	}
+
+	if since := c.Query("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "since must be a positive duration, e.g. 10m"})
+		}
+		sinceSeconds := int64(d.Seconds())
+		opts.SinceSeconds = &sinceSeconds
+	}
+
+	if tail := c.Query("tail"); tail != "" {
+		tailLines := int64(c.QueryInt("tail", -1))
+		if tailLines < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "tail must be a non-negative integer"})
+		}
+		opts.TailLines = &tailLines
+	}
+
+	// The stream outlives the handler, so it can't use the request context
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lines, err := h.botService.StreamLogs(ctx, botID, opts)
+	if err != nil {
+		cancel()
+		switch {
+		case errors.Is(err, storage.ErrBotNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "bot not found"})
+		case errors.Is(err, kubernetes.ErrPodNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "pod not found"})
+		case errors.Is(err, kubernetes.ErrNoPods):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "bot has no running pods"})
+		}
+		h.logger.Errorw("failed to stream logs", "bot_id", botID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stream logs"})
+	}
+
+	sse := strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream")
+	if sse {
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+				if sse {
+					fmt.Fprintf(w, "event: log\ndata: [%s] %s\n\n", line.Pod, line.Text)
+				} else {
+					fmt.Fprintf(w, "[%s] %s\n", line.Pod, line.Text)
+				}
+			case <-keepAlive.C:
+				// Detects clients that went away while the pods are quiet; a flush
+				// only notices a closed connection when it has something to write
+				if sse {
+					fmt.Fprint(w, ": keep-alive\n\n")
+				} else {
+					fmt.Fprint(w, "\n")
+				}
+			}
+
+			if err := w.Flush(); err != nil {
+				h.logger.Debugw("log stream closed by client", "bot_id", botID)
+				return
+			}
+		}
+	})
+
+	return nil
+}
@@ -2,7 +2,9 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
@@ -20,83 +22,130 @@ func NewAdmin(brokers []string, logger *zap.SugaredLogger) *Admin {
 	}
 }
 
+// BotTopic returns the name of one of a bot's topics, e.g. bot_<id>_incoming
+func BotTopic(botID, name string) string {
+	return fmt.Sprintf("bot_%s_%s", botID, name)
+}
+
 func (a *Admin) CreateTopics(ctx context.Context, botID string) error {
+	incomingTopic := BotTopic(botID, "incoming")
+	outgoingTopic := BotTopic(botID, "outgoing")
+	dlqTopic := BotTopic(botID, "dlq")
+	resultsTopic := BotTopic(botID, "results")
+
+	if err := a.createTopics(incomingTopic, outgoingTopic, dlqTopic, resultsTopic); err != nil {
+		return err
+	}
+
+	a.logger.Infow("kafka topics created",
+		"bot_id", botID,
+		"incoming_topic", incomingTopic,
+		"outgoing_topic", outgoingTopic,
+		"dlq_topic", dlqTopic,
+		"results_topic", resultsTopic)
+
+	return nil
+}
+
+// CreateRouteTopics creates bot_<id>_<name> for every routing rule topic.
+// Existing topics are left alone, so rules can be re-applied at any time.
+func (a *Admin) CreateRouteTopics(ctx context.Context, botID string, names []string) error {
+	topics := make([]string, 0, len(names))
+	for _, name := range names {
+		topics = append(topics, BotTopic(botID, name))
+	}
+
+	if err := a.createTopics(topics...); err != nil {
+		return err
+	}
+
+	a.logger.Infow("route topics created", "bot_id", botID, "topics", topics)
+	return nil
+}
+
+// DeleteTopics deletes every topic of the bot, including route topics of rules removed since
+func (a *Admin) DeleteTopics(ctx context.Context, botID string) error {
 	conn, err := kafka.Dial("tcp", a.brokers[0])
 	if err != nil {
 		return fmt.Errorf("failed to dial kafka: %w", err)
 	}
 	defer conn.Close()
 
-	controller, err := conn.Controller()
+	partitions, err := conn.ReadPartitions()
 	if err != nil {
-		return fmt.Errorf("failed to get controller: %w", err)
+		return fmt.Errorf("failed to list topics: %w", err)
 	}
 
-	controllerConn, err := kafka.Dial("tcp", fmt.Sprintf("%s:%d", controller.Host, controller.Port))
-	if err != nil {
-		return fmt.Errorf("failed to dial controller: %w", err)
+	prefix := BotTopic(botID, "")
+	seen := make(map[string]bool)
+	var topics []string
+	for _, p := range partitions {
+		if strings.HasPrefix(p.Topic, prefix) && !seen[p.Topic] {
+			seen[p.Topic] = true
+			topics = append(topics, p.Topic)
+		}
 	}
-	defer controllerConn.Close()
 
-	incomingTopic := fmt.Sprintf("bot_%s_incoming", botID)
-	outgoingTopic := fmt.Sprintf("bot_%s_outgoing", botID)
+	if len(topics) == 0 {
+		return nil
+	}
 
-	topicConfigs := []kafka.TopicConfig{
-		{
-			Topic:             incomingTopic,
-			NumPartitions:     3,
-			ReplicationFactor: 2,
-		},
-		{
-			Topic:             outgoingTopic,
-			NumPartitions:     3,
-			ReplicationFactor: 2,
-		},
+	controllerConn, err := a.dialController()
+	if err != nil {
+		return err
 	}
+	defer controllerConn.Close()
 
-	err = controllerConn.CreateTopics(topicConfigs...)
+	err = controllerConn.DeleteTopics(topics...)
 	if err != nil {
-		return fmt.Errorf("failed to create topics: %w", err)
+		return fmt.Errorf("failed to delete topics: %w", err)
 	}
 
-	a.logger.Infow("kafka topics created",
+	a.logger.Infow("kafka topics deleted",
 		"bot_id", botID,
-		"incoming_topic", incomingTopic,
-		"outgoing_topic", outgoingTopic)
+		"topics", topics)
 
 	return nil
 }
 
-func (a *Admin) DeleteTopics(ctx context.Context, botID string) error {
+// createTopics creates topics one by one so that an already existing topic doesn't fail the rest
+func (a *Admin) createTopics(topics ...string) error {
+	controllerConn, err := a.dialController()
+	if err != nil {
+		return err
+	}
+	defer controllerConn.Close()
+
+	for _, topic := range topics {
+		err := controllerConn.CreateTopics(kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     3,
+			ReplicationFactor: 2,
+		})
+		if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			return fmt.Errorf("failed to create topic %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *Admin) dialController() (*kafka.Conn, error) {
 	conn, err := kafka.Dial("tcp", a.brokers[0])
 	if err != nil {
-		return fmt.Errorf("failed to dial kafka: %w", err)
+		return nil, fmt.Errorf("failed to dial kafka: %w", err)
 	}
 	defer conn.Close()
 
 	controller, err := conn.Controller()
 	if err != nil {
-		return fmt.Errorf("failed to get controller: %w", err)
+		return nil, fmt.Errorf("failed to get controller: %w", err)
 	}
 
 	controllerConn, err := kafka.Dial("tcp", fmt.Sprintf("%s:%d", controller.Host, controller.Port))
 	if err != nil {
-		return fmt.Errorf("failed to dial controller: %w", err)
-	}
-	defer controllerConn.Close()
-
-	incomingTopic := fmt.Sprintf("bot_%s_incoming", botID)
-	outgoingTopic := fmt.Sprintf("bot_%s_outgoing", botID)
-
-	err = controllerConn.DeleteTopics(incomingTopic, outgoingTopic)
-	if err != nil {
-		return fmt.Errorf("failed to delete topics: %w", err)
+		return nil, fmt.Errorf("failed to dial controller: %w", err)
 	}
 
-	a.logger.Infow("kafka topics deleted",
-		"bot_id", botID,
-		"incoming_topic", incomingTopic,
-		"outgoing_topic", outgoingTopic)
-
-	return nil
+	return controllerConn, nil
 }
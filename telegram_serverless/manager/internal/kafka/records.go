@@ -0,0 +1,169 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// readTimeout bounds reading a topic range for the API
+const readTimeout = 10 * time.Second
+
+// Record is a message of a bot topic along with its position
+type Record struct {
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Time      time.Time
+}
+
+// TopicEnds returns the offset after the last message of every partition of the bot's topic
+func (a *Admin) TopicEnds(ctx context.Context, botID, name string) (map[int]int64, error) {
+	topic := BotTopic(botID, name)
+
+	partitions, err := a.partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ends := make(map[int]int64, len(partitions))
+	for _, partition := range partitions {
+		conn, err := kafka.DialLeader(ctx, "tcp", a.brokers[0], topic, partition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial partition leader: %w", err)
+		}
+		end, err := conn.ReadLastOffset()
+		conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read last offset: %w", err)
+		}
+		ends[partition] = end
+	}
+
+	return ends, nil
+}
+
+// ReadRecords reads up to limit records of the bot's topic, in every partition from
+// the offset in from (the start of the partition when absent) to its end
+func (a *Admin) ReadRecords(ctx context.Context, botID, name string, from map[int]int64, limit int) ([]Record, error) {
+	topic := BotTopic(botID, name)
+
+	partitions, err := a.partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for _, partition := range partitions {
+		if len(records) >= limit {
+			break
+		}
+
+		read, err := a.readPartition(ctx, topic, partition, from[partition], limit-len(records))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, read...)
+	}
+
+	return records, nil
+}
+
+// ReadRecord reads the record at offset of one partition of the bot's topic
+func (a *Admin) ReadRecord(ctx context.Context, botID, name string, partition int, offset int64) (*Record, error) {
+	records, err := a.readPartition(ctx, BotTopic(botID, name), partition, offset, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || records[0].Offset != offset {
+		return nil, fmt.Errorf("record not found")
+	}
+	return &records[0], nil
+}
+
+// Publish writes one message to the bot's topic
+func (a *Admin) Publish(ctx context.Context, botID, name string, key, value []byte) error {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(a.brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	defer writer.Close()
+
+	if err := writer.WriteMessages(ctx, kafka.Message{
+		Topic: BotTopic(botID, name),
+		Key:   key,
+		Value: value,
+	}); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+func (a *Admin) readPartition(ctx context.Context, topic string, partition int, from int64, limit int) ([]Record, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", a.brokers[0], topic, partition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial partition leader: %w", err)
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offsets: %w", err)
+	}
+
+	// Records before first were already removed by retention
+	start := max(from, first)
+	if start >= last {
+		return nil, nil
+	}
+
+	if _, err := conn.Seek(start, kafka.SeekAbsolute); err != nil {
+		return nil, fmt.Errorf("failed to seek: %w", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+	var records []Record
+	for len(records) < limit {
+		msg, err := conn.ReadMessage(10e6)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message: %w", err)
+		}
+
+		records = append(records, Record{
+			Partition: partition,
+			Offset:    msg.Offset,
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Time:      msg.Time,
+		})
+
+		if msg.Offset+1 >= last {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+func (a *Admin) partitions(topic string) ([]int, error) {
+	conn, err := kafka.Dial("tcp", a.brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial kafka: %w", err)
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions of %s: %w", topic, err)
+	}
+
+	ids := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
@@ -11,6 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/util/retry"
 )
 
 func (c *Client) CreateBotResources(ctx context.Context, botConfig *models.BotConfig, kafkaBrokers string) error {
@@ -32,11 +33,8 @@ func (c *Client) CreateBotResources(ctx context.Context, botConfig *models.BotCo
 func (c *Client) createSecret(ctx context.Context, botConfig *models.BotConfig) error {
 	secretName := fmt.Sprintf("bot-%s-secrets", botConfig.BotID)
 
-	// Prepare secret data
+	// Custom env vars; the bot token stays with the sidecar, workers don't need it
 	secretData := make(map[string][]byte)
-	secretData["BOT_TOKEN"] = []byte(botConfig.BotToken)
-
-	// Add custom env vars
 	for key, value := range botConfig.EnvVars {
 		secretData[key] = []byte(value)
 	}
@@ -106,14 +104,18 @@ func (c *Client) createDeployment(ctx context.Context, botConfig *models.BotConf
 									Name:  "BOT_ID",
 									Value: botConfig.BotID,
 								},
-								{
-									Name:  "BOT_TOKEN",
-									Value: botConfig.BotToken,
-								},
 								{
 									Name:  "SIDECAR_URL",
 									Value: "http://localhost:8081",
 								},
+								{
+									Name:  "RESULTS_TOPIC",
+									Value: fmt.Sprintf("bot_%s_results", botConfig.BotID),
+								},
+								{
+									Name:  "TELEGRAM_API_URL",
+									Value: botConfig.TelegramAPIURL,
+								},
 							},
 							EnvFrom: []corev1.EnvFromSource{
 								{
@@ -174,6 +176,10 @@ func (c *Client) createDeployment(ctx context.Context, botConfig *models.BotConf
 									Name:  "KAFKA_BROKERS",
 									Value: kafkaBrokers,
 								},
+								{
+									Name:  "TELEGRAM_API_URL",
+									Value: botConfig.TelegramAPIURL,
+								},
 								{
 									Name:  "KAFKA_CONSUMER_GROUP",
 									Value: fmt.Sprintf("bot_%s_workers", botConfig.BotID),
@@ -245,6 +251,55 @@ func (c *Client) DeleteBotResources(ctx context.Context, botID string) error {
 	return nil
 }
 
+// UpdateBotEnv sets an environment variable on every container of a bot deployment
+func (c *Client) UpdateBotEnv(ctx context.Context, botID, name, value string) error {
+	return c.updateEnv(ctx, botID, name, value, "")
+}
+
+// UpdateSidecarEnv sets an environment variable on the sidecar of a bot deployment only
+func (c *Client) UpdateSidecarEnv(ctx context.Context, botID, name, value string) error {
+	return c.updateEnv(ctx, botID, name, value, "sidecar")
+}
+
+// updateEnv sets an environment variable on the named container, or on all containers if container is empty
+func (c *Client) updateEnv(ctx context.Context, botID, name, value, container string) error {
+	deploymentName := fmt.Sprintf("bot-%s", botID)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := c.clientset.AppsV1().Deployments(c.namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		for i := range deployment.Spec.Template.Spec.Containers {
+			spec := &deployment.Spec.Template.Spec.Containers[i]
+			if container != "" && spec.Name != container {
+				continue
+			}
+
+			found := false
+			for j := range spec.Env {
+				if spec.Env[j].Name == name {
+					spec.Env[j].Value = value
+					found = true
+				}
+			}
+			if !found {
+				spec.Env = append(spec.Env, corev1.EnvVar{Name: name, Value: value})
+			}
+		}
+
+		_, err = c.clientset.AppsV1().Deployments(c.namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update deployment env: %w", err)
+	}
+
+	c.logger.Infow("deployment env updated", "deployment_name", deploymentName, "env", name)
+	return nil
+}
+
 // GetDeploymentStatus gets the current status of a bot deployment
 func (c *Client) GetDeploymentStatus(ctx context.Context, botID string) (int32, error) {
 	deploymentName := fmt.Sprintf("bot-%s", botID)
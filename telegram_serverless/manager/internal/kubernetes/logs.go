@@ -0,0 +1,129 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// ErrNoPods is returned when a bot has no pods to stream logs from
+	ErrNoPods = errors.New("bot has no running pods")
+	// ErrPodNotFound is returned for a pod that doesn't belong to the bot
+	ErrPodNotFound = errors.New("pod not found")
+)
+
+// LogOptions selects which worker logs are streamed
+type LogOptions struct {
+	Container    string
+	Pod          string
+	Follow       bool
+	SinceSeconds *int64
+	TailLines    *int64
+}
+
+// LogLine is a single log line tagged with the pod it came from
+type LogLine struct {
+	Pod  string
+	Text string
+}
+
+// ListBotPods returns the names of all pods that belong to a bot
+func (c *Client) ListBotPods(ctx context.Context, botID string) ([]string, error) {
+	pods, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("bot-id=%s", botID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	names := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	return names, nil
+}
+
+// StreamBotLogs merges the logs of all replicas of a bot into a single channel.
+// The channel is closed once every pod stream has ended or ctx is cancelled.
+func (c *Client) StreamBotLogs(ctx context.Context, botID string, opts LogOptions) (<-chan LogLine, error) {
+	pods, err := c.ListBotPods(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Pod != "" {
+		found := false
+		for _, pod := range pods {
+			if pod == opts.Pod {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s does not belong to bot %s", ErrPodNotFound, opts.Pod, botID)
+		}
+		pods = []string{opts.Pod}
+	}
+
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPods, botID)
+	}
+
+	podLogOptions := &corev1.PodLogOptions{
+		Container:    opts.Container,
+		Follow:       opts.Follow,
+		SinceSeconds: opts.SinceSeconds,
+		TailLines:    opts.TailLines,
+	}
+
+	lines := make(chan LogLine, 256)
+	var wg sync.WaitGroup
+	var lastErr error
+	opened := 0
+
+	for _, pod := range pods {
+		stream, err := c.clientset.CoreV1().Pods(c.namespace).GetLogs(pod, podLogOptions).Stream(ctx)
+		if err != nil {
+			c.logger.Warnw("failed to open log stream", "bot_id", botID, "pod", pod, "error", err)
+			lastErr = err
+			continue
+		}
+
+		opened++
+		wg.Add(1)
+		go func(pod string) {
+			defer wg.Done()
+			defer stream.Close()
+
+			scanner := bufio.NewScanner(stream)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				select {
+				case lines <- LogLine{Pod: pod, Text: scanner.Text()}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err := scanner.Err(); err != nil && ctx.Err() == nil {
+				c.logger.Warnw("log stream interrupted", "bot_id", botID, "pod", pod, "error", err)
+			}
+		}(pod)
+	}
+
+	if opened == 0 {
+		return nil, fmt.Errorf("failed to open log stream: %w", lastErr)
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	return lines, nil
+}
@@ -3,25 +3,77 @@ package models
 import "time"
 
 type BotConfig struct {
-	BotID       string            `json:"bot_id"`
-	BotToken    string            `json:"bot_token"`
-	BotName     string            `json:"bot_name"`
-	WorkerImage string            `json:"worker_image"`
-	MinReplicas int32             `json:"min_replicas"`
-	MaxReplicas int32             `json:"max_replicas"`
-	EnvVars     map[string]string `json:"env_vars,omitempty"`
-	CreatedAt   time.Time         `json:"created_at"`
-	UpdatedAt   time.Time         `json:"updated_at"`
-	Status      string            `json:"status"` // created, running, failed, deleting
+	BotID               string            `json:"bot_id"`
+	BotToken            string            `json:"bot_token"`
+	BotName             string            `json:"bot_name"`
+	WorkerImage         string            `json:"worker_image"`
+	MinReplicas         int32             `json:"min_replicas"`
+	MaxReplicas         int32             `json:"max_replicas"`
+	EnvVars             map[string]string `json:"env_vars,omitempty"`
+	TelegramAPIURL      string            `json:"telegram_api_url,omitempty"` // Bot API server, empty means the platform default
+	WebhookID           string            `json:"webhook_id,omitempty"`       // opaque gateway path segment
+	WebhookSecret       string            `json:"webhook_secret,omitempty"`   // sent by Telegram as X-Telegram-Bot-Api-Secret-Token
+	WebhookOptions      *WebhookOptions   `json:"webhook_options,omitempty"`
+	PartitionStrategy   string            `json:"partition_strategy,omitempty"` // Kafka key of incoming updates, empty means by chat
+	DeliveryMode        string            `json:"delivery_mode,omitempty"`      // async or durable, empty means the gateway default
+	Routes              []RoutingRule     `json:"routes,omitempty"`
+	IngestionMode       string            `json:"ingestion_mode,omitempty"`         // webhook or polling, empty means webhook
+	InlineReplies       bool              `json:"inline_replies,omitempty"`         // answer webhooks with the worker's reply when it is fast enough
+	InlineReplyBudget   int               `json:"inline_reply_budget_ms,omitempty"` // 0 means the gateway default
+	OutgoingConcurrency int               `json:"outgoing_concurrency,omitempty"`   // Bot API calls in flight, 0 means the gateway default
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	Status              string            `json:"status"` // created, running, failed, deleting
 }
 
 type CreateBotRequest struct {
-	BotToken    string            `json:"bot_token"`
-	BotName     string            `json:"bot_name"`
-	WorkerImage string            `json:"worker_image"`
-	MinReplicas int32             `json:"min_replicas"`
-	MaxReplicas int32             `json:"max_replicas"`
-	EnvVars     map[string]string `json:"env_vars,omitempty"`
+	BotToken          string                `json:"bot_token"`
+	BotName           string                `json:"bot_name"`
+	WorkerImage       string                `json:"worker_image"`
+	MinReplicas       int32                 `json:"min_replicas"`
+	MaxReplicas       int32                 `json:"max_replicas"`
+	EnvVars           map[string]string     `json:"env_vars,omitempty"`
+	TelegramAPIURL    string                `json:"telegram_api_url,omitempty"`
+	WebhookOptions    *CreateWebhookOptions `json:"webhook_options,omitempty"`
+	PartitionStrategy string                `json:"partition_strategy,omitempty"`
+	DeliveryMode      string                `json:"delivery_mode,omitempty"`
+	IngestionMode     string                `json:"ingestion_mode,omitempty"` // defaults to polling when the gateway has no public https url
+}
+
+// Partition strategies for incoming updates. Updates with the same key land on the
+// same partition, so a worker sees them in order.
+const (
+	PartitionByChat     = "chat"
+	PartitionByUser     = "user"
+	PartitionRoundRobin = "round_robin"
+)
+
+// Delivery modes for incoming updates. In durable mode the gateway answers Telegram
+// only after Kafka acknowledged the update.
+const (
+	DeliveryAsync   = "async"
+	DeliveryDurable = "durable"
+)
+
+// Ingestion modes. In polling mode a gateway replica calls getUpdates for the bot,
+// which works without a public https endpoint.
+const (
+	IngestionWebhook = "webhook"
+	IngestionPolling = "polling"
+)
+
+// WebhookOptions are sent to Telegram on every setWebhook call
+type WebhookOptions struct {
+	AllowedUpdates []string `json:"allowed_updates,omitempty"` // empty means Telegram's default set
+	MaxConnections int      `json:"max_connections,omitempty"` // 1-100, 0 means Telegram's default of 40
+	IPAddress      string   `json:"ip_address,omitempty"`
+}
+
+// CreateWebhookOptions are the webhook options of a new bot. DropPendingUpdates only
+// applies to the first registration and isn't stored with the options.
+type CreateWebhookOptions struct {
+	WebhookOptions
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
 }
 
 type CreateBotResponse struct {
@@ -34,6 +86,8 @@ type CreateBotResponse struct {
 type KafkaTopics struct {
 	Incoming string `json:"incoming"`
 	Outgoing string `json:"outgoing"`
+	DLQ      string `json:"dlq"`     // outgoing commands that failed for good
+	Results  string `json:"results"` // outcomes of outgoing commands sent with a request_id
 }
 
 type UpdateReplicasRequest struct {
@@ -41,13 +95,78 @@ type UpdateReplicasRequest struct {
 	MaxReplicas *int32 `json:"max_replicas,omitempty"`
 }
 
+type UpdateWebhookOptionsRequest struct {
+	AllowedUpdates     *[]string `json:"allowed_updates,omitempty"`
+	MaxConnections     *int      `json:"max_connections,omitempty"`
+	DropPendingUpdates *bool     `json:"drop_pending_updates,omitempty"` // applies to this re-registration only
+	IPAddress          *string   `json:"ip_address,omitempty"`
+}
+
+// RoutingRule sends matching updates to bot_<id>_<topic> instead of the incoming topic.
+// Every condition that is set has to match. Rules are evaluated in order, the first match wins.
+type RoutingRule struct {
+	Topic         string   `json:"topic"`                    // topic name suffix, e.g. "callbacks"
+	UpdateTypes   []string `json:"update_types,omitempty"`   // e.g. "callback_query", "inline_query"
+	CommandPrefix string   `json:"command_prefix,omitempty"` // e.g. "/admin" matches /admin and /admin_ban
+	ChatTypes     []string `json:"chat_types,omitempty"`     // private, group, supergroup or channel
+	TextPattern   string   `json:"text_pattern,omitempty"`   // RE2 regex on the text or caption
+}
+
+type UpdateRoutesRequest struct {
+	Routes []RoutingRule `json:"routes"`
+}
+
+type RoutesResponse struct {
+	Routes []RoutingRule     `json:"routes"`
+	Topics map[string]string `json:"topics"` // rule topic -> kafka topic
+}
+
+// UpdateSettingsRequest changes how the platform handles a bot's traffic
+type UpdateSettingsRequest struct {
+	PartitionStrategy   *string `json:"partition_strategy,omitempty"`
+	DeliveryMode        *string `json:"delivery_mode,omitempty"` // "" resets to the gateway default
+	IngestionMode       *string `json:"ingestion_mode,omitempty"`
+	InlineReplies       *bool   `json:"inline_replies,omitempty"`
+	InlineReplyBudget   *int    `json:"inline_reply_budget_ms,omitempty"`
+	OutgoingConcurrency *int    `json:"outgoing_concurrency,omitempty"`
+}
+
+type RotateTokenRequest struct {
+	BotToken string `json:"bot_token"`
+}
+
+type UpdateTelegramAPIRequest struct {
+	TelegramAPIURL string `json:"telegram_api_url"` // empty resets to the platform default
+}
+
 type BotStatusResponse struct {
-	BotID     string    `json:"bot_id"`
-	BotName   string    `json:"bot_name"`
-	Status    string    `json:"status"`
-	Replicas  Replicas  `json:"replicas"`
-	KafkaLag  int64     `json:"kafka_lag"`
-	CreatedAt time.Time `json:"created_at"`
+	BotID               string          `json:"bot_id"`
+	BotName             string          `json:"bot_name"`
+	Status              string          `json:"status"`
+	Replicas            Replicas        `json:"replicas"`
+	KafkaLag            int64           `json:"kafka_lag"`
+	TelegramAPIURL      string          `json:"telegram_api_url"`
+	WebhookOptions      *WebhookOptions `json:"webhook_options,omitempty"`
+	PartitionStrategy   string          `json:"partition_strategy"`
+	DeliveryMode        string          `json:"delivery_mode,omitempty"`
+	IngestionMode       string          `json:"ingestion_mode"`
+	InlineReplies       bool            `json:"inline_replies"`
+	InlineReplyBudget   int             `json:"inline_reply_budget_ms,omitempty"`
+	OutgoingConcurrency int             `json:"outgoing_concurrency,omitempty"`
+	Webhook             *WebhookStatus  `json:"webhook,omitempty"`
+	CreatedAt           time.Time       `json:"created_at"`
+}
+
+// WebhookStatus is the last observed state of a bot's Telegram webhook
+type WebhookStatus struct {
+	URL                string     `json:"url"`
+	PendingUpdateCount int        `json:"pending_update_count"`
+	LastErrorDate      *time.Time `json:"last_error_date,omitempty"`
+	LastErrorMessage   string     `json:"last_error_message,omitempty"`
+	CheckedAt          time.Time  `json:"checked_at"`
+	LastRegisteredAt   *time.Time `json:"last_registered_at,omitempty"`
+	RegisterError      string     `json:"register_error,omitempty"`
+	RegisterFailures   int        `json:"register_failures,omitempty"`
 }
 
 type Replicas struct {
@@ -55,3 +174,18 @@ type Replicas struct {
 	Min     int32 `json:"min"`
 	Max     int32 `json:"max"`
 }
+
+// Bot lifecycle events published on the bots:events channel
+const (
+	BotEventCreated      = "created"
+	BotEventUpdated      = "updated"
+	BotEventDeleted      = "deleted"
+	BotEventTokenRotated = "token_rotated"
+)
+
+// BotEvent tells gateway replicas that a bot registration changed
+type BotEvent struct {
+	Type      string    `json:"type"`
+	BotID     string    `json:"bot_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
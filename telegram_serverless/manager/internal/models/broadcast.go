@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Broadcast statuses. Only pending, running and paused broadcasts can still change.
+const (
+	BroadcastPending   = "pending"
+	BroadcastRunning   = "running"
+	BroadcastPaused    = "paused"
+	BroadcastCancelled = "cancelled"
+	BroadcastCompleted = "completed"
+)
+
+type CreateBroadcastRequest struct {
+	Method      string                 `json:"method,omitempty"` // defaults to sendMessage
+	Params      map[string]interface{} `json:"params"`           // chat_id is set per recipient
+	ChatIDs     []int64                `json:"chat_ids,omitempty"`
+	UseAudience bool                   `json:"use_audience,omitempty"` // every private chat that talked to the bot
+}
+
+// Broadcast is one message sent to many chats. The gateway delivers it within
+// Telegram's rate limits and keeps the counters up to date.
+type Broadcast struct {
+	ID          string                 `json:"broadcast_id"`
+	BotID       string                 `json:"bot_id"`
+	Method      string                 `json:"method"`
+	Params      map[string]interface{} `json:"params"`
+	Status      string                 `json:"status"`
+	Total       int64                  `json:"total"`
+	Sent        int64                  `json:"sent"`
+	Failed      int64                  `json:"failed"`
+	Blocked     int64                  `json:"blocked"` // the user blocked the bot or left the chat
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+}
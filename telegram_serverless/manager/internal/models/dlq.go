@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter is an outgoing command the gateway gave up on, as published to bot_<id>_dlq
+type DeadLetter struct {
+	BotID     string          `json:"bot_id"`
+	Command   json.RawMessage `json:"command"` // the worker's command without its bot token
+	Error     string          `json:"error"`
+	ErrorCode int             `json:"error_code,omitempty"` // Bot API error code, absent for network errors
+	Attempts  int             `json:"attempts"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+// DLQEntry is a dead letter together with its id, <partition>-<offset> in the dlq topic
+type DLQEntry struct {
+	ID string `json:"entry_id"`
+	DeadLetter
+}
+
+type ReplayResponse struct {
+	Replayed int `json:"replayed"`
+}
@@ -1,11 +1,19 @@
 package routes
 
 import (
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/uchebnick/telegram-serverless/manager/internal/handlers"
+	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
 )
 
+// logStreamWriteTimeout replaces the regular write timeout for log streams,
+// which stay open for as long as the client follows them
+const logStreamWriteTimeout = 24 * time.Hour
+
 type Server struct {
 	app      *fiber.App
 	logger   *zap.SugaredLogger
@@ -19,6 +27,14 @@ func NewServer(handlers *handlers.Handlers, logger *zap.SugaredLogger) *Server {
 		IdleTimeout:  60 * 1e9,
 	})
 
+	app.Server().HeaderReceived = func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+		path, _, _ := strings.Cut(string(header.RequestURI()), "?")
+		if strings.HasSuffix(path, "/logs") {
+			return fasthttp.RequestConfig{WriteTimeout: logStreamWriteTimeout}
+		}
+		return fasthttp.RequestConfig{}
+	}
+
 	return &Server{
 		app:      app,
 		logger:   logger,
@@ -32,6 +48,25 @@ func (s *Server) setupRoutes() {
 	s.app.Get("/bots/:bot_id", s.handlers.GetBot)
 	s.app.Delete("/bots/:bot_id", s.handlers.DeleteBot)
 	s.app.Patch("/bots/:bot_id/replicas", s.handlers.UpdateReplicas)
+	s.app.Patch("/bots/:bot_id/webhook", s.handlers.UpdateWebhookOptions)
+	s.app.Patch("/bots/:bot_id/settings", s.handlers.UpdateSettings)
+	s.app.Get("/bots/:bot_id/routes", s.handlers.GetRoutes)
+	s.app.Put("/bots/:bot_id/routes", s.handlers.UpdateRoutes)
+	s.app.Patch("/bots/:bot_id/telegram-api", s.handlers.UpdateTelegramAPI)
+	s.app.Put("/bots/:bot_id/token", s.handlers.RotateToken)
+	s.app.Get("/bots/:bot_id/logs", s.handlers.StreamLogs)
+	s.app.Get("/bots/:bot_id/dlq", s.handlers.ListDeadLetters)
+	s.app.Delete("/bots/:bot_id/dlq", s.handlers.PurgeDeadLetters)
+	s.app.Post("/bots/:bot_id/dlq/replay", s.handlers.ReplayDeadLetters)
+	s.app.Get("/bots/:bot_id/dlq/:entry_id", s.handlers.GetDeadLetter)
+	s.app.Delete("/bots/:bot_id/dlq/:entry_id", s.handlers.DiscardDeadLetter)
+	s.app.Post("/bots/:bot_id/dlq/:entry_id/replay", s.handlers.ReplayDeadLetter)
+	s.app.Post("/bots/:bot_id/broadcasts", s.handlers.CreateBroadcast)
+	s.app.Get("/bots/:bot_id/broadcasts", s.handlers.ListBroadcasts)
+	s.app.Get("/broadcasts/:broadcast_id", s.handlers.GetBroadcast)
+	s.app.Post("/broadcasts/:broadcast_id/pause", s.handlers.PauseBroadcast)
+	s.app.Post("/broadcasts/:broadcast_id/resume", s.handlers.ResumeBroadcast)
+	s.app.Post("/broadcasts/:broadcast_id/cancel", s.handlers.CancelBroadcast)
 
 	s.app.Get("/health", healthHandler)
 	s.app.Get("/ready", readyHandler)
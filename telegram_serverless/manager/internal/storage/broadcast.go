@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/broadcaststatus"
+	"github.com/uchebnick/telegram-serverless/manager/internal/models"
+)
+
+// Broadcasts live in a hash at broadcast:<id> that the gateway updates while sending,
+// with recipients in the list broadcast:<id>:recipients; broadcaststatus owns the keys
+// and the status transitions.
+
+// recipientBatch bounds the size of a single RPUSH
+const recipientBatch = 1000
+
+// CreateBroadcast stores the broadcast with its recipients and hands it to the gateways
+func (r *RedisStorage) CreateBroadcast(ctx context.Context, broadcast *models.Broadcast, chatIDs []int64) error {
+	params, err := json.Marshal(broadcast.Params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal broadcast params: %w", err)
+	}
+
+	for start := 0; start < len(chatIDs); start += recipientBatch {
+		end := min(start+recipientBatch, len(chatIDs))
+		values := make([]interface{}, 0, end-start)
+		for _, chatID := range chatIDs[start:end] {
+			values = append(values, chatID)
+		}
+		if err := r.client.RPush(ctx, broadcaststatus.RecipientsKey(broadcast.ID), values...).Err(); err != nil {
+			return fmt.Errorf("failed to save broadcast recipients: %w", err)
+		}
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, broadcaststatus.Key(broadcast.ID),
+		"bot_id", broadcast.BotID,
+		"method", broadcast.Method,
+		"params", params,
+		"status", broadcast.Status,
+		"total", broadcast.Total,
+		"cursor", 0,
+		"sent", 0,
+		"failed", 0,
+		"blocked", 0,
+		"created_at", broadcast.CreatedAt.Unix(),
+		"updated_at", broadcast.UpdatedAt.Unix())
+	pipe.SAdd(ctx, fmt.Sprintf("bot:broadcasts:%s", broadcast.BotID), broadcast.ID)
+	pipe.SAdd(ctx, broadcaststatus.ActiveKey, broadcast.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save broadcast: %w", err)
+	}
+	return nil
+}
+
+// AudienceChatIDs returns the private chats the gateway recorded for a bot
+func (r *RedisStorage) AudienceChatIDs(ctx context.Context, botID string) ([]int64, error) {
+	members, err := r.client.SMembers(ctx, fmt.Sprintf("bot:audience:%s", botID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audience: %w", err)
+	}
+
+	chatIDs := make([]int64, 0, len(members))
+	for _, member := range members {
+		chatID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+	return chatIDs, nil
+}
+
+func (r *RedisStorage) GetBroadcast(ctx context.Context, id string) (*models.Broadcast, error) {
+	fields, err := r.client.HGetAll(ctx, broadcaststatus.Key(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get broadcast: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, broadcaststatus.ErrNotFound
+	}
+
+	broadcast := &models.Broadcast{
+		ID:        id,
+		BotID:     fields["bot_id"],
+		Method:    fields["method"],
+		Status:    fields["status"],
+		Total:     parseInt(fields["total"]),
+		Sent:      parseInt(fields["sent"]),
+		Failed:    parseInt(fields["failed"]),
+		Blocked:   parseInt(fields["blocked"]),
+		CreatedAt: time.Unix(parseInt(fields["created_at"]), 0).UTC(),
+		UpdatedAt: time.Unix(parseInt(fields["updated_at"]), 0).UTC(),
+	}
+	if completedAt := parseInt(fields["completed_at"]); completedAt > 0 {
+		t := time.Unix(completedAt, 0).UTC()
+		broadcast.CompletedAt = &t
+	}
+	if err := json.Unmarshal([]byte(fields["params"]), &broadcast.Params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal broadcast params: %w", err)
+	}
+
+	return broadcast, nil
+}
+
+// ListBroadcasts returns the ids of every broadcast of a bot
+func (r *RedisStorage) ListBroadcasts(ctx context.Context, botID string) ([]string, error) {
+	ids, err := r.client.SMembers(ctx, fmt.Sprintf("bot:broadcasts:%s", botID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list broadcasts: %w", err)
+	}
+	return ids, nil
+}
+
+// ForgetBroadcast drops a broadcast that expired from the bot's list
+func (r *RedisStorage) ForgetBroadcast(ctx context.Context, botID, id string) error {
+	if err := r.client.SRem(ctx, fmt.Sprintf("bot:broadcasts:%s", botID), id).Err(); err != nil {
+		return fmt.Errorf("failed to forget broadcast: %w", err)
+	}
+	return nil
+}
+
+// SetBroadcastStatus moves a broadcast to status if its current status is one of from.
+// It reports false when the broadcast is in another status.
+func (r *RedisStorage) SetBroadcastStatus(ctx context.Context, id, status string, from ...string) (bool, error) {
+	return broadcaststatus.Set(ctx, r.client, id, status, from...)
+}
+
+// DeleteBotBroadcasts removes every broadcast of a bot, stopping those still running
+func (r *RedisStorage) DeleteBotBroadcasts(ctx context.Context, botID string) error {
+	ids, err := r.ListBroadcasts(ctx, botID)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.Pipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, broadcaststatus.Key(id), broadcaststatus.RecipientsKey(id))
+		pipe.SRem(ctx, broadcaststatus.ActiveKey, id)
+	}
+	pipe.Del(ctx, fmt.Sprintf("bot:broadcasts:%s", botID))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete broadcasts: %w", err)
+	}
+	return nil
+}
+
+func parseInt(val string) int64 {
+	n, _ := strconv.ParseInt(val, 10, 64)
+	return n
+}
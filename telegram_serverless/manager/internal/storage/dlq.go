@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Kafka can't delete single messages, so the DLQ's state lives in Redis: the offset per
+// partition where live entries start, moved forward by a purge, and the entries that were
+// replayed or discarded since.
+
+func dlqStartKey(botID string) string {
+	return fmt.Sprintf("bot:dlq_start:%s", botID)
+}
+
+func dlqHandledKey(botID string) string {
+	return fmt.Sprintf("bot:dlq_handled:%s", botID)
+}
+
+// DLQStart returns the first live offset of every purged dlq partition
+func (r *RedisStorage) DLQStart(ctx context.Context, botID string) (map[int]int64, error) {
+	fields, err := r.client.HGetAll(ctx, dlqStartKey(botID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dlq start: %w", err)
+	}
+
+	start := make(map[int]int64, len(fields))
+	for field, val := range fields {
+		partition, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		start[partition] = parseInt(val)
+	}
+	return start, nil
+}
+
+// PurgeDLQ hides every entry before ends and forgets the entries handled one by one
+func (r *RedisStorage) PurgeDLQ(ctx context.Context, botID string, ends map[int]int64) error {
+	pipe := r.client.TxPipeline()
+	for partition, end := range ends {
+		pipe.HSet(ctx, dlqStartKey(botID), strconv.Itoa(partition), end)
+	}
+	pipe.Del(ctx, dlqHandledKey(botID))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to purge dlq: %w", err)
+	}
+	return nil
+}
+
+// DLQHandled returns the ids of the entries replayed or discarded since the last purge
+func (r *RedisStorage) DLQHandled(ctx context.Context, botID string) (map[string]bool, error) {
+	ids, err := r.client.SMembers(ctx, dlqHandledKey(botID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get handled dlq entries: %w", err)
+	}
+
+	handled := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		handled[id] = true
+	}
+	return handled, nil
+}
+
+// MarkDLQHandled hides a replayed or discarded entry
+func (r *RedisStorage) MarkDLQHandled(ctx context.Context, botID string, entryIDs ...string) error {
+	if len(entryIDs) == 0 {
+		return nil
+	}
+
+	members := make([]interface{}, 0, len(entryIDs))
+	for _, id := range entryIDs {
+		members = append(members, id)
+	}
+	if err := r.client.SAdd(ctx, dlqHandledKey(botID), members...).Err(); err != nil {
+		return fmt.Errorf("failed to mark dlq entry handled: %w", err)
+	}
+	return nil
+}
@@ -3,12 +3,23 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/uchebnick/telegram-serverless/manager/internal/models"
 )
 
+// botEventsChannel is the pub/sub channel gateway replicas listen on to invalidate cached bots
+const botEventsChannel = "bots:events"
+
+// ErrBotNotFound is returned for bots that don't exist
+var ErrBotNotFound = errors.New("bot not found")
+
+// maxTxAttempts bounds how often a watched update starts over after a concurrent write
+const maxTxAttempts = 5
+
 type RedisStorage struct {
 	client *redis.Client
 }
@@ -28,35 +39,109 @@ func NewRedisStorage(addr, password string, db int) (*RedisStorage, error) {
 	return &RedisStorage{client: client}, nil
 }
 
+// SaveBot stores bot configuration in Redis. A webhook identity that is already
+// stored survives configs read before it was assigned.
 func (r *RedisStorage) SaveBot(ctx context.Context, botConfig *models.BotConfig) error {
-	data, err := json.Marshal(botConfig)
-	if err != nil {
-		return fmt.Errorf("failed to marshal bot config: %w", err)
-	}
-
 	configKey := fmt.Sprintf("bot:config:%s", botConfig.BotID)
-	if err := r.client.Set(ctx, configKey, data, 0).Err(); err != nil {
-		return fmt.Errorf("failed to save bot config: %w", err)
-	}
 
-	tokenKey := fmt.Sprintf("bot:token:%s", botConfig.BotToken)
-	if err := r.client.Set(ctx, tokenKey, botConfig.BotID, 0).Err(); err != nil {
-		return fmt.Errorf("failed to save token mapping: %w", err)
-	}
+	return r.watch(ctx, func(tx *redis.Tx) error {
+		stored, err := getBot(ctx, tx, botConfig.BotID)
+		if err != nil && !errors.Is(err, ErrBotNotFound) {
+			return err
+		}
+		if stored != nil && botConfig.WebhookID == "" {
+			botConfig.WebhookID = stored.WebhookID
+			botConfig.WebhookSecret = stored.WebhookSecret
+		}
+
+		data, err := json.Marshal(botConfig)
+		if err != nil {
+			return fmt.Errorf("failed to marshal bot config: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, configKey, data, 0)
+			pipe.Set(ctx, fmt.Sprintf("bot:token:%s", botConfig.BotToken), botConfig.BotID, 0)
+			if botConfig.WebhookID != "" {
+				pipe.Set(ctx, fmt.Sprintf("bot:webhook:%s", botConfig.WebhookID), botConfig.BotID, 0)
+			}
+			pipe.SAdd(ctx, "bots:all", botConfig.BotID)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save bot config: %w", err)
+		}
+		return nil
+	}, configKey)
+}
+
+// AssignWebhookIdentity gives a bot the webhook ID and secret it is missing, leaving
+// whichever it already has. It returns the bot as stored afterwards.
+func (r *RedisStorage) AssignWebhookIdentity(ctx context.Context, botID, webhookID, webhookSecret string) (*models.BotConfig, error) {
+	configKey := fmt.Sprintf("bot:config:%s", botID)
+
+	var botConfig *models.BotConfig
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		stored, err := getBot(ctx, tx, botID)
+		if err != nil {
+			return err
+		}
+		botConfig = stored
+		if stored.WebhookID != "" && stored.WebhookSecret != "" {
+			return nil
+		}
+
+		if stored.WebhookID == "" {
+			stored.WebhookID = webhookID
+		}
+		if stored.WebhookSecret == "" {
+			stored.WebhookSecret = webhookSecret
+		}
+		stored.UpdatedAt = time.Now()
 
-	if err := r.client.SAdd(ctx, "bots:all", botConfig.BotID).Err(); err != nil {
-		return fmt.Errorf("failed to add bot to list: %w", err)
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return fmt.Errorf("failed to marshal bot config: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, configKey, data, 0)
+			pipe.Set(ctx, fmt.Sprintf("bot:webhook:%s", stored.WebhookID), botID, 0)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save webhook identity: %w", err)
+		}
+		return nil
+	}, configKey)
+	if err != nil {
+		return nil, err
 	}
+	return botConfig, nil
+}
 
-	return nil
+// watch runs fn in a transaction on keys, starting over while other writers
+// change them in between
+func (r *RedisStorage) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxTxAttempts; i++ {
+		err := r.client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update %v: too many concurrent writes", keys)
 }
 
 // GetBot retrieves bot configuration from Redis
 func (r *RedisStorage) GetBot(ctx context.Context, botID string) (*models.BotConfig, error) {
+	return getBot(ctx, r.client, botID)
+}
+
+func getBot(ctx context.Context, client redis.Cmdable, botID string) (*models.BotConfig, error) {
 	key := fmt.Sprintf("bot:config:%s", botID)
-	data, err := r.client.Get(ctx, key).Result()
+	data, err := client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return nil, fmt.Errorf("bot not found")
+		return nil, ErrBotNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get bot config: %w", err)
@@ -71,14 +156,23 @@ func (r *RedisStorage) GetBot(ctx context.Context, botID string) (*models.BotCon
 }
 
 // DeleteBot removes bot configuration from Redis
-func (r *RedisStorage) DeleteBot(ctx context.Context, botID string, botToken string) error {
-	configKey := fmt.Sprintf("bot:config:%s", botID)
-	tokenKey := fmt.Sprintf("bot:token:%s", botToken)
+func (r *RedisStorage) DeleteBot(ctx context.Context, botConfig *models.BotConfig) error {
+	configKey := fmt.Sprintf("bot:config:%s", botConfig.BotID)
+	tokenKey := fmt.Sprintf("bot:token:%s", botConfig.BotToken)
+	webhookStatusKey := fmt.Sprintf("bot:webhook_status:%s", botConfig.BotID)
 
 	pipe := r.client.Pipeline()
 	pipe.Del(ctx, configKey)
 	pipe.Del(ctx, tokenKey)
-	pipe.SRem(ctx, "bots:all", botID)
+	pipe.Del(ctx, webhookStatusKey)
+	pipe.Del(ctx, fmt.Sprintf("bot:poll_offset:%s", botConfig.BotID))
+	pipe.Del(ctx, fmt.Sprintf("bot:audience:%s", botConfig.BotID))
+	pipe.Del(ctx, dlqStartKey(botConfig.BotID), dlqHandledKey(botConfig.BotID))
+	pipe.Del(ctx, fmt.Sprintf("bot:chat_migrations:%s", botConfig.BotID))
+	if botConfig.WebhookID != "" {
+		pipe.Del(ctx, fmt.Sprintf("bot:webhook:%s", botConfig.WebhookID))
+	}
+	pipe.SRem(ctx, "bots:all", botConfig.BotID)
 
 	_, err := pipe.Exec(ctx)
 	return err
@@ -93,6 +187,34 @@ func (r *RedisStorage) ListBots(ctx context.Context) ([]string, error) {
 	return botIDs, nil
 }
 
+// RotateToken saves a bot under its new token and drops the mapping of the old one
+func (r *RedisStorage) RotateToken(ctx context.Context, botConfig *models.BotConfig, oldToken string) error {
+	if err := r.SaveBot(ctx, botConfig); err != nil {
+		return err
+	}
+
+	oldTokenKey := fmt.Sprintf("bot:token:%s", oldToken)
+	if err := r.client.Del(ctx, oldTokenKey).Err(); err != nil {
+		return fmt.Errorf("failed to delete old token mapping: %w", err)
+	}
+
+	return nil
+}
+
+// PublishBotEvent notifies gateway replicas about a bot registration change
+func (r *RedisStorage) PublishBotEvent(ctx context.Context, event *models.BotEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bot event: %w", err)
+	}
+
+	if err := r.client.Publish(ctx, botEventsChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish bot event: %w", err)
+	}
+
+	return nil
+}
+
 func (r *RedisStorage) UpdateBotStatus(ctx context.Context, botID, status string) error {
 	botConfig, err := r.GetBot(ctx, botID)
 	if err != nil {
@@ -103,6 +225,40 @@ func (r *RedisStorage) UpdateBotStatus(ctx context.Context, botID, status string
 	return r.SaveBot(ctx, botConfig)
 }
 
+// SaveWebhookStatus stores the last observed webhook state of a bot
+func (r *RedisStorage) SaveWebhookStatus(ctx context.Context, botID string, status *models.WebhookStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook status: %w", err)
+	}
+
+	key := fmt.Sprintf("bot:webhook_status:%s", botID)
+	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save webhook status: %w", err)
+	}
+
+	return nil
+}
+
+// GetWebhookStatus returns the last observed webhook state of a bot, or nil if it was never checked
+func (r *RedisStorage) GetWebhookStatus(ctx context.Context, botID string) (*models.WebhookStatus, error) {
+	key := fmt.Sprintf("bot:webhook_status:%s", botID)
+	data, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook status: %w", err)
+	}
+
+	var status models.WebhookStatus
+	if err := json.Unmarshal([]byte(data), &status); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook status: %w", err)
+	}
+
+	return &status, nil
+}
+
 func (r *RedisStorage) Close() error {
 	return r.client.Close()
 }
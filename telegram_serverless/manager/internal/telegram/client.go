@@ -0,0 +1,55 @@
+package telegram
+
+import (
+	"context"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/botapi"
+	"go.uber.org/zap"
+)
+
+// CloudAPIURL is the address of Telegram's hosted Bot API
+const CloudAPIURL = botapi.CloudAPIURL
+
+// callTimeout bounds every call, including setWebhook with its certificate upload
+const callTimeout = 20 * time.Second
+
+// Client is safe for concurrent use
+type Client struct {
+	api    *botapi.Client
+	logger *zap.SugaredLogger
+}
+
+func NewClient(apiURL string, logger *zap.SugaredLogger) *Client {
+	return &Client{
+		api:    botapi.NewClient(apiURL, callTimeout, callTimeout),
+		logger: logger,
+	}
+}
+
+// WithBaseURL returns a client that talks to another Bot API server.
+// An empty apiURL keeps the current server.
+func (c *Client) WithBaseURL(apiURL string) *Client {
+	api := c.api.WithBaseURL(apiURL)
+	if api == c.api {
+		return c
+	}
+	return &Client{api: api, logger: c.logger}
+}
+
+// BaseURL returns the Bot API server the client talks to
+func (c *Client) BaseURL() string {
+	return c.api.BaseURL()
+}
+
+// call sends params as a JSON body and decodes the method's result into result unless
+// it is nil. Nil params send an empty body.
+func (c *Client) call(ctx context.Context, botToken, method string, params, result interface{}) error {
+	return c.api.Call(ctx, botToken, method, params, result)
+}
+
+// callMultipart sends params as form fields along with files, for methods that upload files
+func (c *Client) callMultipart(ctx context.Context, botToken, method string, params map[string]interface{}, files []botapi.InputFile) error {
+	_, err := c.api.PostMultipart(ctx, botToken, method, params, files)
+	return err
+}
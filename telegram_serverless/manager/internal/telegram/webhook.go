@@ -2,114 +2,104 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"mime/multipart"
-	"net/http"
-	"time"
+	"strconv"
 
-	"go.uber.org/zap"
+	"github.com/uchebnick/telegram-serverless/botapi"
 )
 
-type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     *zap.SugaredLogger
+// WebhookInfo is the subset of getWebhookInfo the manager tracks
+type WebhookInfo struct {
+	URL                  string `json:"url"`
+	HasCustomCertificate bool   `json:"has_custom_certificate"`
+	PendingUpdateCount   int    `json:"pending_update_count"`
+	LastErrorDate        int64  `json:"last_error_date,omitempty"`
+	LastErrorMessage     string `json:"last_error_message,omitempty"`
 }
 
-func NewClient(apiURL string, logger *zap.SugaredLogger) *Client {
-	return &Client{
-		baseURL: apiURL,
-		httpClient: &http.Client{
-			Timeout: 20 * time.Second,
-		},
-		logger: logger,
-	}
+// SetWebhookParams are the setWebhook parameters the manager controls
+type SetWebhookParams struct {
+	URL                string
+	SecretToken        string
+	Certificate        []byte
+	AllowedUpdates     []string
+	MaxConnections     int
+	DropPendingUpdates bool
+	IPAddress          string
 }
 
-func (c *Client) SetWebhook(botToken, webhookURL string, certificate []byte) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/setWebhook", botToken)
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// DeleteWebhookParams are the parameters of deleteWebhook
+type DeleteWebhookParams struct {
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+}
 
-	if err := writer.WriteField("url", webhookURL); err != nil {
-		return fmt.Errorf("failed to write url field: %w", err)
+// SetWebhook is sent as a form since it may upload the gateway's certificate
+func (c *Client) SetWebhook(ctx context.Context, botToken string, params SetWebhookParams) error {
+	// allowed_updates is always sent: when omitted Telegram keeps the previous list
+	allowedUpdates := params.AllowedUpdates
+	if allowedUpdates == nil {
+		allowedUpdates = []string{}
 	}
-
-	if len(certificate) > 0 {
-		part, err := writer.CreateFormFile("certificate", "ca.crt")
-		if err != nil {
-			return fmt.Errorf("failed to create form file: %w", err)
-		}
-		if _, err := part.Write(certificate); err != nil {
-			return fmt.Errorf("failed to write certificate data: %w", err)
-		}
+	allowedUpdatesJSON, err := json.Marshal(allowedUpdates)
+	if err != nil {
+		return fmt.Errorf("failed to marshal allowed_updates: %w", err)
 	}
 
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close multipart writer: %w", err)
+	fields := map[string]interface{}{
+		"url":             params.URL,
+		"allowed_updates": string(allowedUpdatesJSON),
 	}
-
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if params.SecretToken != "" {
+		fields["secret_token"] = params.SecretToken
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+	if params.MaxConnections > 0 {
+		fields["max_connections"] = strconv.Itoa(params.MaxConnections)
+	}
+	if params.DropPendingUpdates {
+		fields["drop_pending_updates"] = "true"
+	}
+	if params.IPAddress != "" {
+		fields["ip_address"] = params.IPAddress
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var result struct {
-			Description string `json:"description"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			return fmt.Errorf("failed to decode error response: %w", err)
-		}
-		return fmt.Errorf("failed to set webhook: %s", result.Description)
+	var files []botapi.InputFile
+	if len(params.Certificate) > 0 {
+		files = append(files, botapi.InputFile{Field: "certificate", Filename: "ca.crt", Reader: bytes.NewReader(params.Certificate)})
 	}
 
+	if err := c.callMultipart(ctx, botToken, "setWebhook", fields, files); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
 	return nil
 }
 
 // DeleteWebhook deletes the webhook for a bot
-func (c *Client) DeleteWebhook(botToken string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/deleteWebhook", botToken)
-
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+func (c *Client) DeleteWebhook(ctx context.Context, botToken string) error {
+	if err := c.call(ctx, botToken, "deleteWebhook", DeleteWebhookParams{}, nil); err != nil {
+		return err
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
-	}
+	c.logger.Info("webhook deleted successfully")
+	return nil
+}
 
-	var result struct {
-		Ok          bool   `json:"ok"`
-		Description string `json:"description"`
-	}
+// LogOut logs the bot out of the cloud Bot API before it is served by a local server
+func (c *Client) LogOut(ctx context.Context, botToken string) error {
+	return c.call(ctx, botToken, "logOut", nil, nil)
+}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
-	}
+// Close closes the bot instance on a local Bot API server before it moves elsewhere
+func (c *Client) Close(ctx context.Context, botToken string) error {
+	return c.call(ctx, botToken, "close", nil, nil)
+}
 
-	if !result.Ok {
-		return fmt.Errorf("telegram handlers error: %s", result.Description)
+// GetWebhookInfo returns the current webhook state of a bot
+func (c *Client) GetWebhookInfo(ctx context.Context, botToken string) (*WebhookInfo, error) {
+	var info WebhookInfo
+	if err := c.call(ctx, botToken, "getWebhookInfo", nil, &info); err != nil {
+		return nil, err
 	}
-
-	c.logger.Info("webhook deleted successfully")
-	return nil
+	return &info, nil
 }
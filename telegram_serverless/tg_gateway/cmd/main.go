@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/signal"
@@ -10,9 +12,18 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/audience"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/blob"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/broadcast"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/config"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/dedup"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ingress"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/inline"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/kafka"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/outgoing"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/polling"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ratelimit"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/registry"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/routes"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/telegram"
@@ -32,7 +43,12 @@ func main() {
 
 	logger.Info("starting tg_gateway",
 		zap.String("port", cfg.Port),
-		zap.Strings("kafka_brokers", cfg.KafkaBrokers))
+		zap.Strings("kafka_brokers", cfg.KafkaBrokers),
+		zap.String("telegram_api_url", cfg.TelegramAPIURL),
+		zap.String("delivery_mode", cfg.DeliveryMode))
+	for _, warning := range cfg.Warnings {
+		logger.Warn("invalid config value", zap.String("warning", warning))
+	}
 
 	redisStorage, err := storage.NewRedisStorage(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
 	if err != nil {
@@ -40,21 +56,107 @@ func main() {
 	}
 	defer redisStorage.Close()
 
-	producer := kafka.NewProducer(cfg.KafkaBrokers, logger)
+	producer := kafka.NewProducer(cfg.KafkaBrokers, cfg.KafkaBatchSize, cfg.KafkaBatchTimeout, logger)
 	defer producer.Close()
 
-	tgClient := telegram.NewClient(cfg.TelegramAPIURL, logger)
-
-	webhookHandler := webhook.NewHandler(redisStorage, producer, logger)
-
-	outgoingProcessor := outgoing.NewProcessor(cfg.KafkaBrokers, "tg-gateway-outgoing", tgClient, logger)
+	tgClient := telegram.NewClient(cfg.TelegramAPIURL)
+
+	botRegistry := registry.NewRegistry(redisStorage, cfg.BotCacheSize, cfg.BotCacheTTL, cfg.BotCacheNegativeTTL, logger)
+
+	deduplicator := dedup.NewDeduplicator(redisStorage, cfg.DedupTTL, cfg.DedupWindowSize, logger)
+
+	instance := instanceID()
+	inlineReplies := inline.NewReplies(redisStorage, producer, instance, logger)
+
+	audienceRecorder := audience.NewRecorder(redisStorage, logger)
+
+	webhookHandler := webhook.NewHandler(botRegistry, deduplicator, producer, inlineReplies, audienceRecorder, cfg.DeliveryMode, cfg.InlineReplyBudget, logger)
+
+	sendLimiter := ratelimit.NewSendLimiter(redisStorage, ratelimit.Limits{
+		BotRate:         cfg.OutgoingBotRate,
+		PaidRate:        cfg.OutgoingPaidRate,
+		PrivateChatRate: cfg.OutgoingPrivateChatRate,
+		GroupChatRate:   cfg.OutgoingGroupChatRate,
+	}, logger)
+
+	blobStore := blob.NewStore(blob.Config{
+		InlineMaxBytes: cfg.AttachmentInlineMaxBytes,
+		LocalDir:       cfg.BlobLocalDir,
+		S3: blob.S3Config{
+			Endpoint:        cfg.BlobS3Endpoint,
+			Region:          cfg.BlobS3Region,
+			AccessKeyID:     cfg.BlobS3AccessKeyID,
+			SecretAccessKey: cfg.BlobS3SecretAccessKey,
+			PathStyle:       cfg.BlobS3PathStyle,
+		},
+	})
+
+	outgoingProcessor := outgoing.NewProcessor(cfg.KafkaBrokers, "tg-gateway-outgoing", tgClient, botRegistry, redisStorage,
+		producer, blobStore, sendLimiter, outgoing.Config{
+			MaxQueued:      cfg.OutgoingMaxQueued,
+			BotConcurrency: cfg.OutgoingBotConcurrency,
+			MaxAttempts:    cfg.OutgoingMaxAttempts,
+			RetryBaseDelay: cfg.OutgoingRetryBaseDelay,
+			RetryMaxDelay:  cfg.OutgoingRetryMaxDelay,
+			MaxFloodWait:   cfg.OutgoingMaxFloodWait,
+
+			DiscoveryInterval: cfg.OutgoingDiscoveryInterval,
+		}, logger)
+
+	guard, err := ingress.NewGuard(ingress.Config{
+		AllowedCIDRs:   cfg.IngressAllowedCIDRs,
+		TrustedProxies: cfg.IngressTrustedProxies,
+		BotRate:        cfg.IngressBotRate,
+		BotBurst:       cfg.IngressBotBurst,
+		IPRate:         cfg.IngressIPRate,
+		IPBurst:        cfg.IngressIPBurst,
+	}, logger)
+	if err != nil {
+		logger.Fatal("failed to initialize ingress guard", zap.Error(err))
+	}
 
-	server := routes.NewServer(webhookHandler, logger)
+	server := routes.NewServer(webhookHandler, guard, botRegistry, cfg.AllowTokenWebhooks, cfg.MaxBodyBytes, logger)
 	metricsServer := newMetricsServer(cfg.MetricsPort, logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	pollingDone := make(chan struct{})
+	if cfg.PollingEnabled {
+		pollingManager := polling.NewManager(redisStorage, botRegistry, webhookHandler, tgClient,
+			instance, cfg.PollLeaseTTL, cfg.PollSyncInterval, logger)
+		go func() {
+			defer close(pollingDone)
+			pollingManager.Start(ctx)
+		}()
+	} else {
+		close(pollingDone)
+	}
+
+	broadcastDone := make(chan struct{})
+	if cfg.BroadcastEnabled {
+		broadcaster := broadcast.NewBroadcaster(redisStorage, botRegistry, tgClient, sendLimiter,
+			instance, cfg.BroadcastRate, cfg.BroadcastSyncInterval, logger)
+		go func() {
+			defer close(broadcastDone)
+			broadcaster.Start(ctx)
+		}()
+	} else {
+		close(broadcastDone)
+	}
+
+	// Stopped after the http server so chats of the last webhooks are still flushed
+	audienceCtx, stopAudience := context.WithCancel(context.Background())
+	defer stopAudience()
+	audienceDone := make(chan struct{})
+	go func() {
+		defer close(audienceDone)
+		audienceRecorder.Start(audienceCtx)
+	}()
+
+	go botRegistry.Watch(ctx)
+	go inlineReplies.Start(ctx)
+
 	go func() {
 		if err := outgoingProcessor.Start(ctx); err != nil {
 			logger.Error("outgoing processor error", zap.Error(err))
@@ -80,9 +182,16 @@ func main() {
 
 	outgoingProcessor.Stop()
 
+	// Pollers and broadcasters release their leases so another replica takes over right away
+	cancel()
+	<-pollingDone
+	<-broadcastDone
+
 	if err := server.Shutdown(); err != nil {
 		logger.Error("http server shutdown error", zap.Error(err))
 	}
+	stopAudience()
+	<-audienceDone
 	if err := metricsServer.Shutdown(); err != nil {
 		logger.Error("metrics server shutdown error", zap.Error(err))
 	}
@@ -90,6 +199,14 @@ func main() {
 	logger.Info("tg_gateway stopped")
 }
 
+// instanceID identifies this replica as the owner of leases and inline reply waits
+func instanceID() string {
+	hostname, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(b))
+}
+
 func newMetricsServer(port string, logger *zap.SugaredLogger) *fiber.App {
 	app := fiber.New()
 	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
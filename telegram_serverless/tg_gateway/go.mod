@@ -7,6 +7,8 @@ require (
 	github.com/prometheus/client_golang v1.19.0
 	github.com/redis/go-redis/v9 v9.5.1
 	github.com/segmentio/kafka-go v0.4.47
+	github.com/uchebnick/telegram-serverless/botapi v0.0.0
+	github.com/uchebnick/telegram-serverless/broadcaststatus v0.0.0
 	go.uber.org/zap v1.27.0
 )
 
@@ -32,3 +34,8 @@ require (
 	golang.org/x/sys v0.17.0 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
 )
+
+replace (
+	github.com/uchebnick/telegram-serverless/botapi => ../botapi
+	github.com/uchebnick/telegram-serverless/broadcaststatus => ../broadcaststatus
+)
@@ -0,0 +1,104 @@
+package audience
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	flushInterval = time.Second
+
+	// maxPending bounds the chats buffered between flushes; past it new chats are
+	// dropped and picked up again the next time they write
+	maxPending = 10000
+
+	flushTimeout = 5 * time.Second
+)
+
+// Recorder collects the private chats that talked to a bot, its broadcast audience,
+// and writes them to Redis in batches off the webhook path
+type Recorder struct {
+	storage *storage.RedisStorage
+	logger  *zap.SugaredLogger
+
+	mu      sync.Mutex
+	pending map[string]map[int64]struct{}
+	size    int
+}
+
+func NewRecorder(storage *storage.RedisStorage, logger *zap.SugaredLogger) *Recorder {
+	return &Recorder{
+		storage: storage,
+		logger:  logger,
+		pending: make(map[string]map[int64]struct{}),
+	}
+}
+
+// Add queues chatID of botID for the next flush. It never blocks on Redis; a chat
+// that writes many times between flushes costs a single SADD member.
+func (r *Recorder) Add(botID string, chatID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size >= maxPending {
+		return
+	}
+	chats, ok := r.pending[botID]
+	if !ok {
+		chats = make(map[int64]struct{})
+		r.pending[botID] = chats
+	}
+	if _, ok := chats[chatID]; ok {
+		return
+	}
+	chats[chatID] = struct{}{}
+	r.size++
+}
+
+// Start flushes queued chats every second until ctx is cancelled, then flushes
+// what is left
+func (r *Recorder) Start(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.flush(context.Background())
+			return
+		case <-ticker.C:
+			r.flush(ctx)
+		}
+	}
+}
+
+func (r *Recorder) flush(ctx context.Context) {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]map[int64]struct{})
+	r.size = 0
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	chatIDs := make(map[string][]int64, len(pending))
+	for botID, chats := range pending {
+		for chatID := range chats {
+			chatIDs[botID] = append(chatIDs[botID], chatID)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, flushTimeout)
+	defer cancel()
+
+	if err := r.storage.AddAudience(ctx, chatIDs); err != nil {
+		// Lost chats are recorded again the next time they write to the bot
+		r.logger.Error("failed to record audience", zap.Int("bots", len(chatIDs)), zap.Error(err))
+	}
+}
@@ -0,0 +1,164 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// unsignedPayload is what a SigV4 request without a body hash signs
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+const (
+	// dialTimeout and responseHeaderTimeout bound an unreachable or stalled storage;
+	// the body itself is streamed and bounded by the caller's context
+	dialTimeout           = 10 * time.Second
+	responseHeaderTimeout = 30 * time.Second
+)
+
+type S3Config struct {
+	Endpoint        string // e.g. https://s3.eu-central-1.amazonaws.com or a MinIO url
+	Region          string
+	AccessKeyID     string // empty for anonymous access
+	SecretAccessKey string
+	PathStyle       bool // bucket in the path instead of the host name, as MinIO expects
+}
+
+// S3Client downloads objects from S3-compatible storage, signing requests with SigV4
+type S3Client struct {
+	cfg        S3Config
+	endpoint   *url.URL
+	httpClient *http.Client
+}
+
+func NewS3Client(cfg S3Config) *S3Client {
+	endpoint, _ := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	return &S3Client{
+		cfg:      cfg,
+		endpoint: endpoint,
+		// No overall timeout, the body is streamed while the upload to Telegram runs
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
+				TLSHandshakeTimeout:   dialTimeout,
+				ResponseHeaderTimeout: responseHeaderTimeout,
+			},
+		},
+	}
+}
+
+// Get streams an object. A missing object is reported as ErrInvalidAttachment.
+func (c *S3Client) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	if c.endpoint == nil || c.endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: invalid s3 endpoint %q", ErrInvalidAttachment, c.cfg.Endpoint)
+	}
+
+	host := c.endpoint.Host
+	path := "/" + escapePath(key)
+	if c.cfg.PathStyle {
+		path = "/" + escapePath(bucket) + path
+	} else {
+		host = bucket + "." + host
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint.Scheme+"://"+host+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	c.sign(req, host, path, time.Now().UTC())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get s3 object: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: s3://%s/%s returned status %d", ErrInvalidAttachment, bucket, key, resp.StatusCode)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get s3 object s3://%s/%s: status %d", bucket, key, resp.StatusCode)
+	}
+}
+
+// sign adds an AWS Signature Version 4 for a GET without query parameters
+func (c *S3Client) sign(req *http.Request, host, path string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	if c.cfg.AccessKeyID == "" {
+		return
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		path,
+		"",
+		"host:" + host,
+		"x-amz-content-sha256:" + unsignedPayload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := date + "/" + c.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// escapePath encodes an object key the way SigV4 expects: every byte but the
+// unreserved characters, keeping the slashes
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		if ch == '/' || ch == '-' || ch == '_' || ch == '.' || ch == '~' ||
+			('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
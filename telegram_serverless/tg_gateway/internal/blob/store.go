@@ -0,0 +1,132 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+)
+
+// ErrInvalidAttachment marks attachments that can never be opened, e.g. a missing
+// object or inline data over the limit, so the command isn't retried
+var ErrInvalidAttachment = errors.New("invalid attachment")
+
+type Config struct {
+	InlineMaxBytes int64  // limit of base64 attachments carried in the command itself
+	LocalDir       string // root of local:// references, one subdirectory per bot; empty disables them
+	S3             S3Config
+}
+
+// Store opens the content of command attachments, whether inline, in S3-compatible
+// storage (s3://bucket/key) or on a volume shared with the workers (local://path).
+// References are scoped per bot: s3 keys must be below bots/<bot_id>/ and local paths
+// are resolved in LocalDir/<bot_id>, so a worker can't send another bot's files.
+type Store struct {
+	inlineMax int64
+	localDir  string
+	s3        *S3Client
+}
+
+func NewStore(cfg Config) *Store {
+	store := &Store{
+		inlineMax: cfg.InlineMaxBytes,
+		localDir:  cfg.LocalDir,
+	}
+	if cfg.S3.Endpoint != "" {
+		store.s3 = NewS3Client(cfg.S3)
+	}
+	return store
+}
+
+// Open returns the content of an attachment of botID's command. The caller closes it.
+func (s *Store) Open(ctx context.Context, botID string, att models.Attachment) (io.ReadCloser, error) {
+	if att.URL == "" {
+		if s.inlineMax > 0 && int64(len(att.Data)) > s.inlineMax {
+			return nil, fmt.Errorf("%w: %s is %d bytes, inline attachments are limited to %d",
+				ErrInvalidAttachment, att.Name, len(att.Data), s.inlineMax)
+		}
+		return io.NopCloser(bytes.NewReader(att.Data)), nil
+	}
+
+	ref, err := url.Parse(att.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s has a malformed url: %v", ErrInvalidAttachment, att.Name, err)
+	}
+
+	switch ref.Scheme {
+	case "s3":
+		if s.s3 == nil {
+			return nil, fmt.Errorf("%w: %s: s3 storage is not configured", ErrInvalidAttachment, att.Name)
+		}
+		key := strings.TrimPrefix(ref.Path, "/")
+		if !inBotPrefix(botID, key) {
+			return nil, fmt.Errorf("%w: %s: s3 keys must be below %s", ErrInvalidAttachment, att.Name, botPrefix(botID))
+		}
+		return s.s3.Get(ctx, ref.Host, key)
+	case "local":
+		return s.openLocal(botID, att.Name, ref.Host+ref.Path)
+	default:
+		return nil, fmt.Errorf("%w: %s: unsupported url scheme %q", ErrInvalidAttachment, att.Name, ref.Scheme)
+	}
+}
+
+// botPrefix is the part of the s3 key space that belongs to a bot
+func botPrefix(botID string) string {
+	return "bots/" + botID + "/"
+}
+
+// inBotPrefix reports whether key is below the bot's prefix, after resolving dot segments
+func inBotPrefix(botID, key string) bool {
+	if botID == "" || strings.Contains(botID, "/") {
+		return false
+	}
+	clean := path.Clean("/" + key)
+	return strings.HasPrefix(clean, "/"+botPrefix(botID)) && clean == "/"+key
+}
+
+// openLocal opens name's file below the bot's directory of the local root, refusing
+// paths and symlinks that escape it
+func (s *Store) openLocal(botID, name, ref string) (io.ReadCloser, error) {
+	if s.localDir == "" {
+		return nil, fmt.Errorf("%w: %s: local storage is not configured", ErrInvalidAttachment, name)
+	}
+	if botID == "" || strings.ContainsAny(botID, `/\`) || botID == "." || botID == ".." {
+		return nil, fmt.Errorf("%w: %s: invalid bot id %q", ErrInvalidAttachment, name, botID)
+	}
+
+	root, err := filepath.EvalSymlinks(filepath.Join(s.localDir, botID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s: %s does not exist", ErrInvalidAttachment, name, ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the local directory of bot %s: %w", botID, err)
+	}
+
+	full, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+ref)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s: %s does not exist", ErrInvalidAttachment, name, ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	if !strings.HasPrefix(full, root+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%w: %s: %s points outside the bot's directory", ErrInvalidAttachment, name, ref)
+	}
+
+	f, err := os.Open(full)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s: %s does not exist", ErrInvalidAttachment, name, ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", ref, err)
+	}
+	return f, nil
+}
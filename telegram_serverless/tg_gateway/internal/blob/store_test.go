@@ -0,0 +1,109 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+)
+
+func TestInBotPrefix(t *testing.T) {
+	tests := []struct {
+		name  string
+		botID string
+		key   string
+		want  bool
+	}{
+		{"own key", "42", "bots/42/chart.png", true},
+		{"nested key", "42", "bots/42/reports/2026/q3.pdf", true},
+		{"other bot", "42", "bots/43/chart.png", false},
+		{"bot id prefix of another", "4", "bots/42/chart.png", false},
+		{"outside bots", "42", "chart.png", false},
+		{"prefix only", "42", "bots/42/", false},
+		{"dot segments", "42", "bots/42/../43/chart.png", false},
+		{"empty bot id", "", "bots//chart.png", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inBotPrefix(tt.botID, tt.key); got != tt.want {
+				t.Errorf("inBotPrefix(%q, %q) = %v, want %v", tt.botID, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenLocal(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"42/reports", "43"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"42/reports/q3.pdf", "43/secret.pdf"} {
+		if err := os.WriteFile(filepath.Join(root, file), []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "43", "secret.pdf"), filepath.Join(root, "42", "escape.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "42", "reports", "q3.pdf"), filepath.Join(root, "42", "latest.pdf")); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(Config{LocalDir: root})
+
+	tests := []struct {
+		name    string
+		botID   string
+		url     string
+		want    string
+		wantErr error
+	}{
+		{"own file", "42", "local://reports/q3.pdf", "42/reports/q3.pdf", nil},
+		{"symlink inside", "42", "local://latest.pdf", "42/reports/q3.pdf", nil},
+		{"dot segments stay inside", "42", "local://../43/secret.pdf", "", ErrInvalidAttachment},
+		{"symlink escaping", "42", "local://escape.pdf", "", ErrInvalidAttachment},
+		{"missing file", "42", "local://missing.pdf", "", ErrInvalidAttachment},
+		{"bot without a directory", "44", "local://reports/q3.pdf", "", ErrInvalidAttachment},
+		{"bot id with a separator", "42/..", "local://43/secret.pdf", "", ErrInvalidAttachment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := store.Open(context.Background(), tt.botID, models.Attachment{Name: "document", URL: tt.url})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer content.Close()
+
+			data, err := io.ReadAll(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Open() content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenS3OutsideBotPrefix(t *testing.T) {
+	store := NewStore(Config{S3: S3Config{Endpoint: "http://127.0.0.1:1"}})
+
+	_, err := store.Open(context.Background(), "42", models.Attachment{Name: "photo", URL: "s3://media/bots/43/chart.png"})
+	if !errors.Is(err, ErrInvalidAttachment) {
+		t.Fatalf("Open() error = %v, want %v", err, ErrInvalidAttachment)
+	}
+}
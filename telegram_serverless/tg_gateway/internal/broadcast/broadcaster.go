@@ -0,0 +1,417 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/botapi"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ratelimit"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/registry"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/telegram"
+	"go.uber.org/zap"
+)
+
+const (
+	leaseTTL = 30 * time.Second
+	// recipientBatch is how many chat ids are read from Redis at once
+	recipientBatch = 100
+	// maxAttempts bounds retries of a recipient after transport errors
+	maxAttempts = 3
+	// errorBackoff is the pause after a failed Redis or Bot API call
+	errorBackoff = 5 * time.Second
+	// defaultRate stays below Telegram's limit of about 30 messages per second per bot
+	defaultRate = 25
+)
+
+// Broadcaster sends the broadcasts created through the manager. A bot's broadcasts are
+// sent one at a time, oldest first, by the replica holding the bot's broadcast lease,
+// so the rate limit holds across replicas.
+type Broadcaster struct {
+	storage      *storage.RedisStorage
+	registry     *registry.Registry
+	tgClient     *telegram.Client
+	limiter      *ratelimit.SendLimiter
+	owner        string
+	interval     time.Duration // between two messages of a bot
+	syncInterval time.Duration
+	logger       *zap.SugaredLogger
+
+	mu      sync.Mutex
+	senders map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewBroadcaster(
+	storage *storage.RedisStorage,
+	registry *registry.Registry,
+	tgClient *telegram.Client,
+	limiter *ratelimit.SendLimiter,
+	owner string,
+	rate float64,
+	syncInterval time.Duration,
+	logger *zap.SugaredLogger,
+) *Broadcaster {
+	if rate <= 0 {
+		rate = defaultRate
+	}
+
+	return &Broadcaster{
+		storage:      storage,
+		registry:     registry,
+		tgClient:     tgClient,
+		limiter:      limiter,
+		owner:        owner,
+		interval:     time.Duration(float64(time.Second) / rate),
+		syncInterval: syncInterval,
+		logger:       logger,
+		senders:      make(map[string]context.CancelFunc),
+	}
+}
+
+// Start picks up bots with broadcasts to send until ctx is cancelled,
+// then waits for senders to release their leases
+func (b *Broadcaster) Start(ctx context.Context) {
+	ticker := time.NewTicker(b.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		b.sync(ctx)
+
+		select {
+		case <-ctx.Done():
+			b.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync starts a sender for every bot with a sendable broadcast whose lease is free
+func (b *Broadcaster) sync(ctx context.Context) {
+	queued, err := b.queued(ctx)
+	if err != nil {
+		b.logger.Error("failed to list broadcasts", zap.Error(err))
+		return
+	}
+
+	for botID := range queued {
+		if b.running(botID) {
+			continue
+		}
+
+		acquired, err := b.storage.AcquireLease(ctx, leaseKey(botID), b.owner, leaseTTL)
+		if err != nil {
+			b.logger.Error("failed to acquire broadcast lease", zap.String("bot_id", botID), zap.Error(err))
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		b.startSender(ctx, botID)
+	}
+}
+
+// queued returns the pending and running broadcasts by bot, oldest first.
+// Paused broadcasts stay active but are left alone until resumed.
+func (b *Broadcaster) queued(ctx context.Context) (map[string][]*models.Broadcast, error) {
+	ids, err := b.storage.ListActiveBroadcasts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queued := make(map[string][]*models.Broadcast)
+	for _, id := range ids {
+		broadcast, err := b.storage.GetBroadcast(ctx, id)
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				b.logger.Error("failed to get broadcast", zap.String("broadcast_id", id), zap.Error(err))
+			}
+			continue
+		}
+
+		if broadcast.Status == models.BroadcastPending || broadcast.Status == models.BroadcastRunning {
+			queued[broadcast.BotID] = append(queued[broadcast.BotID], broadcast)
+		}
+	}
+
+	for _, broadcasts := range queued {
+		sort.Slice(broadcasts, func(i, j int) bool {
+			return broadcasts[i].CreatedAt < broadcasts[j].CreatedAt
+		})
+	}
+
+	return queued, nil
+}
+
+func (b *Broadcaster) running(botID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.senders[botID]
+	return ok
+}
+
+func (b *Broadcaster) startSender(ctx context.Context, botID string) {
+	sendCtx, cancel := context.WithCancel(ctx)
+
+	b.mu.Lock()
+	b.senders[botID] = cancel
+	b.mu.Unlock()
+
+	b.wg.Add(2)
+	go func() {
+		defer b.wg.Done()
+		b.keepLease(sendCtx, cancel, botID)
+	}()
+	go func() {
+		defer b.wg.Done()
+		defer b.stopSender(botID)
+		b.send(sendCtx, botID)
+	}()
+}
+
+func (b *Broadcaster) stopSender(botID string) {
+	b.mu.Lock()
+	cancel, ok := b.senders[botID]
+	delete(b.senders, botID)
+	b.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+
+	// The parent context may be gone already, releasing must still reach Redis
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	if err := b.storage.ReleaseLease(ctx, leaseKey(botID), b.owner); err != nil {
+		b.logger.Error("failed to release broadcast lease", zap.String("bot_id", botID), zap.Error(err))
+	}
+}
+
+// keepLease renews the lease at a third of its ttl and stops the sender once it is lost.
+// Renewals that keep failing for a whole ttl count as lost too: the lease has expired
+// by then and another replica may be sending the same broadcast.
+func (b *Broadcaster) keepLease(ctx context.Context, cancel context.CancelFunc, botID string) {
+	ticker := time.NewTicker(leaseTTL / 3)
+	defer ticker.Stop()
+
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewed, err := b.storage.RenewLease(ctx, leaseKey(botID), b.owner, leaseTTL)
+		if err != nil {
+			b.logger.Error("failed to renew broadcast lease", zap.String("bot_id", botID), zap.Error(err))
+			if time.Since(renewedAt) >= leaseTTL {
+				b.logger.Warn("broadcast lease expired while it couldn't be renewed", zap.String("bot_id", botID))
+				cancel()
+				return
+			}
+			continue
+		}
+		if !renewed {
+			b.logger.Warn("broadcast lease lost", zap.String("bot_id", botID))
+			cancel()
+			return
+		}
+		renewedAt = time.Now()
+	}
+}
+
+// send delivers the bot's broadcasts one after another until none is left to send
+func (b *Broadcaster) send(ctx context.Context, botID string) {
+	for ctx.Err() == nil {
+		queued, err := b.queued(ctx)
+		if err != nil {
+			b.logger.Error("failed to list broadcasts", zap.String("bot_id", botID), zap.Error(err))
+			return
+		}
+		if len(queued[botID]) == 0 {
+			return
+		}
+
+		if err := b.run(ctx, queued[botID][0]); err != nil && ctx.Err() == nil {
+			b.logger.Error("broadcast interrupted",
+				zap.String("bot_id", botID),
+				zap.String("broadcast_id", queued[botID][0].ID),
+				zap.Error(err))
+			sleep(ctx, errorBackoff)
+		}
+	}
+}
+
+// run sends a broadcast from its cursor on. It returns early, without error, once the
+// broadcast is paused, cancelled or deleted. Progress is stored after every message,
+// so a crash resends at most the message in flight.
+func (b *Broadcaster) run(ctx context.Context, broadcast *models.Broadcast) error {
+	settings, err := b.registry.ByBotID(ctx, broadcast.BotID)
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err = b.storage.SetBroadcastStatus(ctx, broadcast.ID, models.BroadcastCancelled,
+			models.BroadcastPending, models.BroadcastRunning)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve bot: %w", err)
+	}
+
+	if broadcast.Status == models.BroadcastPending {
+		started, err := b.storage.SetBroadcastStatus(ctx, broadcast.ID, models.BroadcastRunning, models.BroadcastPending)
+		if err != nil || !started {
+			return err
+		}
+		b.logger.Info("broadcast started",
+			zap.String("bot_id", broadcast.BotID),
+			zap.String("broadcast_id", broadcast.ID),
+			zap.Int64("total", broadcast.Total))
+	}
+
+	client := b.tgClient.WithBaseURL(settings.TelegramAPIURL)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+send:
+	for cursor := broadcast.Cursor; cursor < broadcast.Total; {
+		chatIDs, err := b.storage.BroadcastRecipients(ctx, broadcast.ID, cursor, recipientBatch)
+		if err != nil {
+			return err
+		}
+		if len(chatIDs) == 0 {
+			// Fewer recipients than counted, nothing is left to send
+			break send
+		}
+
+		for _, chatID := range chatIDs {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			// Pause and cancel take effect before the next message
+			status, err := b.storage.GetBroadcastStatus(ctx, broadcast.ID)
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if status != models.BroadcastRunning {
+				b.logger.Info("broadcast stopped",
+					zap.String("broadcast_id", broadcast.ID),
+					zap.String("status", status))
+				return nil
+			}
+
+			result := b.deliver(ctx, client, settings, broadcast, chatID)
+			if ctx.Err() != nil {
+				// Shutting down mid-message; whoever takes over resends it
+				return nil
+			}
+
+			metrics.BroadcastMessages.WithLabelValues(result).Inc()
+			if err := b.storage.RecordBroadcastResult(ctx, broadcast.ID, result); err != nil {
+				return err
+			}
+			cursor++
+		}
+	}
+
+	completed, err := b.storage.SetBroadcastStatus(ctx, broadcast.ID, models.BroadcastCompleted, models.BroadcastRunning)
+	if err != nil {
+		return err
+	}
+	if completed {
+		b.logger.Info("broadcast completed",
+			zap.String("bot_id", broadcast.BotID),
+			zap.String("broadcast_id", broadcast.ID))
+	}
+	return nil
+}
+
+// deliver sends the broadcast to one chat and returns the result it counts as.
+// Flood limit errors are waited out; other Bot API errors are not retried.
+func (b *Broadcaster) deliver(
+	ctx context.Context,
+	client *telegram.Client,
+	settings *models.BotSettings,
+	broadcast *models.Broadcast,
+	chatID int64,
+) string {
+	params := make(map[string]interface{}, len(broadcast.Params)+1)
+	for k, v := range broadcast.Params {
+		params[k] = v
+	}
+	params["chat_id"] = chatID
+
+	// The broadcast rate leaves room for the bot's other traffic, which shares the bot's limits
+	if err := b.limiter.Wait(ctx, broadcast.BotID, broadcast.Method, params); err != nil {
+		return models.BroadcastFailed
+	}
+
+	for attempt := 1; ; {
+		_, err := client.CallMethodContext(ctx, settings.BotToken, broadcast.Method, params)
+		if err == nil {
+			return models.BroadcastSent
+		}
+
+		var tgErr *botapi.Error
+		if errors.As(err, &tgErr) {
+			switch tgErr.ErrorCode {
+			case 429:
+				b.logger.Warn("broadcast hit flood limit",
+					zap.String("bot_id", broadcast.BotID),
+					zap.Int("retry_after", tgErr.RetryAfter))
+				sleep(ctx, time.Duration(max(tgErr.RetryAfter, 1))*time.Second)
+				if ctx.Err() != nil {
+					return models.BroadcastFailed
+				}
+				continue
+			case 403:
+				// The user blocked the bot or the bot was removed from the chat
+				if err := b.storage.RemoveAudience(ctx, broadcast.BotID, chatID); err != nil {
+					b.logger.Error("failed to remove audience", zap.String("bot_id", broadcast.BotID), zap.Error(err))
+				}
+				return models.BroadcastBlocked
+			default:
+				b.logger.Debug("broadcast message rejected",
+					zap.String("broadcast_id", broadcast.ID),
+					zap.Int64("chat_id", chatID),
+					zap.Error(err))
+				return models.BroadcastFailed
+			}
+		}
+
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			b.logger.Error("failed to send broadcast message",
+				zap.String("broadcast_id", broadcast.ID),
+				zap.Int64("chat_id", chatID),
+				zap.Error(err))
+			return models.BroadcastFailed
+		}
+		attempt++
+		sleep(ctx, errorBackoff)
+	}
+}
+
+func leaseKey(botID string) string {
+	return fmt.Sprintf("bot:broadcaster:%s", botID)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -1,35 +1,186 @@
 package config
 
 import (
+	"fmt"
+	"math"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Port                 string
-	KafkaBrokers         []string
-	RedisAddr            string
-	RedisPassword        string
-	RedisDB              int
-	TelegramAPIURL       string
-	MetricsPort          string
-	LogLevel             string
-	OutgoingTopicPattern string
+	Port                string
+	KafkaBrokers        []string
+	RedisAddr           string
+	RedisPassword       string
+	RedisDB             int
+	TelegramAPIURL      string
+	MetricsPort         string
+	LogLevel            string
+	AllowTokenWebhooks  bool
+	BotCacheSize        int
+	BotCacheTTL         time.Duration
+	BotCacheNegativeTTL time.Duration
+	DedupTTL            time.Duration
+	DedupWindowSize     int
+	DeliveryMode        string
+	KafkaBatchSize      int
+	KafkaBatchTimeout   time.Duration
+
+	// Ingress protection of the webhook endpoints
+	IngressAllowedCIDRs   []string // empty accepts any source
+	IngressTrustedProxies []string
+	IngressBotRate        float64
+	IngressBotBurst       int
+	IngressIPRate         float64
+	IngressIPBurst        int
+	MaxBodyBytes          int
+
+	// Polling ingestion for bots without a webhook
+	PollingEnabled   bool
+	PollLeaseTTL     time.Duration
+	PollSyncInterval time.Duration
+
+	// InlineReplyBudget is how long a webhook waits for a worker's reply by default
+	InlineReplyBudget time.Duration
+
+	// Broadcast delivery, paced per bot
+	BroadcastEnabled      bool
+	BroadcastRate         float64 // messages per second
+	BroadcastSyncInterval time.Duration
+
+	// Bot API sending limits for outgoing commands, in messages per second
+	OutgoingBotRate           float64
+	OutgoingPaidRate          float64
+	OutgoingPrivateChatRate   float64
+	OutgoingGroupChatRate     float64
+	OutgoingMaxQueued         int
+	OutgoingBotConcurrency    int
+	OutgoingMaxAttempts       int
+	OutgoingRetryBaseDelay    time.Duration
+	OutgoingRetryMaxDelay     time.Duration
+	OutgoingMaxFloodWait      time.Duration
+	OutgoingDiscoveryInterval time.Duration
+
+	// Attachments of outgoing commands
+	AttachmentInlineMaxBytes int64
+	BlobLocalDir             string
+	BlobS3Endpoint           string
+	BlobS3Region             string
+	BlobS3AccessKeyID        string
+	BlobS3SecretAccessKey    string
+	BlobS3PathStyle          bool
+
+	// Warnings describe settings that were invalid and replaced by their defaults;
+	// they are logged once the logger exists
+	Warnings []string
 }
 
 func Load() *Config {
-	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
+	// Bad values fall back to their defaults: unparsed they would silently become 0,
+	// e.g. a dedup ttl of 0 keeps published markers forever
+	var warnings []string
+	redisDB := getEnvNonNegativeInt("REDIS_DB", 0, &warnings)
+	allowTokenWebhooks := getEnvBool("ALLOW_TOKEN_WEBHOOKS", true, &warnings)
+	botCacheSize := getEnvPositiveInt("BOT_CACHE_SIZE", 10000, &warnings)
+	botCacheTTL := getEnvPositiveDuration("BOT_CACHE_TTL", 5*time.Minute, &warnings)
+	botCacheNegativeTTL := getEnvPositiveDuration("BOT_CACHE_NEGATIVE_TTL", 30*time.Second, &warnings)
+	dedupTTL := getEnvPositiveDuration("DEDUP_TTL", 24*time.Hour, &warnings)
+	dedupWindowSize := getEnvPositiveInt("DEDUP_WINDOW_SIZE", 1000, &warnings)
+	kafkaBatchSize := getEnvPositiveInt("KAFKA_BATCH_SIZE", 100, &warnings)
+	kafkaBatchTimeout := getEnvPositiveDuration("KAFKA_BATCH_TIMEOUT", 5*time.Millisecond, &warnings)
+	ingressAllowlist := getEnvBool("INGRESS_ALLOWLIST_ENABLED", false, &warnings)
+	ingressBotRate := getEnvNonNegativeFloat("INGRESS_BOT_RATE", 0, &warnings) // 0 disables
+	ingressBotBurst := getEnvPositiveInt("INGRESS_BOT_BURST", 100, &warnings)
+	ingressIPRate := getEnvNonNegativeFloat("INGRESS_IP_RATE", 0, &warnings) // 0 disables
+	ingressIPBurst := getEnvPositiveInt("INGRESS_IP_BURST", 200, &warnings)
+	maxBodyBytes := getEnvPositiveInt("MAX_BODY_BYTES", 1048576, &warnings)
+	pollingEnabled := getEnvBool("POLLING_ENABLED", true, &warnings)
+	pollLeaseTTL := getEnvPositiveDuration("POLL_LEASE_TTL", 30*time.Second, &warnings)
+	pollSyncInterval := getEnvPositiveDuration("POLL_SYNC_INTERVAL", 15*time.Second, &warnings)
+	inlineReplyBudget := getEnvPositiveDuration("INLINE_REPLY_BUDGET", 300*time.Millisecond, &warnings)
+	broadcastEnabled := getEnvBool("BROADCAST_ENABLED", true, &warnings)
+	broadcastRate := getEnvPositiveFloat("BROADCAST_RATE", 25, &warnings)
+	broadcastSyncInterval := getEnvPositiveDuration("BROADCAST_SYNC_INTERVAL", 5*time.Second, &warnings)
+	outgoingBotRate := getEnvPositiveFloat("OUTGOING_BOT_RATE", 30, &warnings)
+	outgoingPaidRate := getEnvPositiveFloat("OUTGOING_PAID_RATE", 1000, &warnings)
+	outgoingPrivateChatRate := getEnvPositiveFloat("OUTGOING_PRIVATE_CHAT_RATE", 1, &warnings)
+	outgoingGroupChatPerMinute := getEnvPositiveFloat("OUTGOING_GROUP_CHAT_PER_MINUTE", 20, &warnings)
+	outgoingMaxQueued := getEnvPositiveInt("OUTGOING_MAX_QUEUED", 10000, &warnings)
+	outgoingBotConcurrency := getEnvPositiveInt("OUTGOING_BOT_CONCURRENCY", 8, &warnings)
+	outgoingMaxAttempts := getEnvPositiveInt("OUTGOING_MAX_ATTEMPTS", 5, &warnings)
+	outgoingRetryBaseDelay := getEnvPositiveDuration("OUTGOING_RETRY_BASE_DELAY", 500*time.Millisecond, &warnings)
+	outgoingRetryMaxDelay := getEnvPositiveDuration("OUTGOING_RETRY_MAX_DELAY", 30*time.Second, &warnings)
+	outgoingMaxFloodWait := getEnvPositiveDuration("OUTGOING_MAX_FLOOD_WAIT", 5*time.Minute, &warnings)
+	outgoingDiscoveryInterval := getEnvPositiveDuration("OUTGOING_DISCOVERY_INTERVAL", 5*time.Minute, &warnings)
+	attachmentInlineMaxBytes := getEnvPositiveInt("ATTACHMENT_INLINE_MAX_BYTES", 1048576, &warnings)
+	blobS3PathStyle := getEnvBool("BLOB_S3_PATH_STYLE", true, &warnings)
+
+	var ingressAllowedCIDRs []string
+	if ingressAllowlist {
+		// Telegram's published webhook subnets
+		ingressAllowedCIDRs = splitList(getEnv("INGRESS_ALLOWED_CIDRS", "149.154.160.0/20,91.108.4.0/22"))
+	}
 
 	return &Config{
-		Port:                 getEnv("PORT", "8080"),
-		KafkaBrokers:         []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
-		RedisAddr:            getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword:        getEnv("REDIS_PASSWORD", ""),
-		RedisDB:              redisDB,
-		TelegramAPIURL:       getEnv("TELEGRAM_API_URL", "https://handlers.telegram.org"),
-		MetricsPort:          getEnv("METRICS_PORT", "9090"),
-		LogLevel:             getEnv("LOG_LEVEL", "info"),
-		OutgoingTopicPattern: getEnv("OUTGOING_TOPIC_PATTERN", "bot_.*_outgoing"),
+		Port:                getEnv("PORT", "8080"),
+		KafkaBrokers:        []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
+		RedisAddr:           getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:       getEnv("REDIS_PASSWORD", ""),
+		RedisDB:             redisDB,
+		TelegramAPIURL:      getEnv("TELEGRAM_API_URL", "https://api.telegram.org"),
+		MetricsPort:         getEnv("METRICS_PORT", "9090"),
+		LogLevel:            getEnv("LOG_LEVEL", "info"),
+		AllowTokenWebhooks:  allowTokenWebhooks,
+		BotCacheSize:        botCacheSize,
+		BotCacheTTL:         botCacheTTL,
+		BotCacheNegativeTTL: botCacheNegativeTTL,
+		DedupTTL:            dedupTTL,
+		DedupWindowSize:     dedupWindowSize,
+		DeliveryMode:        getEnv("DELIVERY_MODE", "async"),
+		KafkaBatchSize:      kafkaBatchSize,
+		KafkaBatchTimeout:   kafkaBatchTimeout,
+
+		IngressAllowedCIDRs:   ingressAllowedCIDRs,
+		IngressTrustedProxies: splitList(getEnv("INGRESS_TRUSTED_PROXIES", "")),
+		IngressBotRate:        ingressBotRate,
+		IngressBotBurst:       ingressBotBurst,
+		IngressIPRate:         ingressIPRate,
+		IngressIPBurst:        ingressIPBurst,
+		MaxBodyBytes:          maxBodyBytes,
+
+		PollingEnabled:   pollingEnabled,
+		PollLeaseTTL:     pollLeaseTTL,
+		PollSyncInterval: pollSyncInterval,
+
+		InlineReplyBudget: inlineReplyBudget,
+
+		BroadcastEnabled:      broadcastEnabled,
+		BroadcastRate:         broadcastRate,
+		BroadcastSyncInterval: broadcastSyncInterval,
+
+		OutgoingBotRate:           outgoingBotRate,
+		OutgoingPaidRate:          outgoingPaidRate,
+		OutgoingPrivateChatRate:   outgoingPrivateChatRate,
+		OutgoingGroupChatRate:     outgoingGroupChatPerMinute / 60,
+		OutgoingMaxQueued:         outgoingMaxQueued,
+		OutgoingBotConcurrency:    outgoingBotConcurrency,
+		OutgoingMaxAttempts:       outgoingMaxAttempts,
+		OutgoingRetryBaseDelay:    outgoingRetryBaseDelay,
+		OutgoingRetryMaxDelay:     outgoingRetryMaxDelay,
+		OutgoingMaxFloodWait:      outgoingMaxFloodWait,
+		OutgoingDiscoveryInterval: outgoingDiscoveryInterval,
+
+		AttachmentInlineMaxBytes: int64(attachmentInlineMaxBytes),
+		BlobLocalDir:             getEnv("BLOB_LOCAL_DIR", ""),
+		BlobS3Endpoint:           getEnv("BLOB_S3_ENDPOINT", ""),
+		BlobS3Region:             getEnv("BLOB_S3_REGION", "us-east-1"),
+		BlobS3AccessKeyID:        getEnv("BLOB_S3_ACCESS_KEY_ID", ""),
+		BlobS3SecretAccessKey:    getEnv("BLOB_S3_SECRET_ACCESS_KEY", ""),
+		BlobS3PathStyle:          blobS3PathStyle,
+
+		Warnings: warnings,
 	}
 }
 
@@ -39,3 +190,91 @@ func getEnv(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// getEnvPositiveInt parses key as a positive integer, falling back to defaultVal
+func getEnvPositiveInt(key string, defaultVal int, warnings *[]string) int {
+	return getEnvInt(key, defaultVal, 1, "a positive integer", warnings)
+}
+
+// getEnvNonNegativeInt parses key as an integer of at least 0, falling back to defaultVal
+func getEnvNonNegativeInt(key string, defaultVal int, warnings *[]string) int {
+	return getEnvInt(key, defaultVal, 0, "a non-negative integer", warnings)
+}
+
+func getEnvInt(key string, defaultVal, minVal int, want string, warnings *[]string) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < minVal {
+		*warnings = append(*warnings, fmt.Sprintf("%s=%q is not %s, using %d", key, val, want, defaultVal))
+		return defaultVal
+	}
+	return n
+}
+
+// getEnvPositiveFloat parses key as a number above 0, falling back to defaultVal
+func getEnvPositiveFloat(key string, defaultVal float64, warnings *[]string) float64 {
+	return getEnvFloat(key, defaultVal, false, warnings)
+}
+
+// getEnvNonNegativeFloat parses key as a number of at least 0, falling back to defaultVal
+func getEnvNonNegativeFloat(key string, defaultVal float64, warnings *[]string) float64 {
+	return getEnvFloat(key, defaultVal, true, warnings)
+}
+
+func getEnvFloat(key string, defaultVal float64, allowZero bool, warnings *[]string) float64 {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || f < 0 || (f == 0 && !allowZero) || math.IsNaN(f) || math.IsInf(f, 0) {
+		want := "a positive number"
+		if allowZero {
+			want = "a non-negative number"
+		}
+		*warnings = append(*warnings, fmt.Sprintf("%s=%q is not %s, using %g", key, val, want, defaultVal))
+		return defaultVal
+	}
+	return f
+}
+
+// getEnvBool parses key as a boolean, falling back to defaultVal
+func getEnvBool(key string, defaultVal bool, warnings *[]string) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("%s=%q is not a boolean, using %t", key, val, defaultVal))
+		return defaultVal
+	}
+	return b
+}
+
+// getEnvPositiveDuration parses key as a positive duration, falling back to defaultVal
+func getEnvPositiveDuration(key string, defaultVal time.Duration, warnings *[]string) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		*warnings = append(*warnings, fmt.Sprintf("%s=%q is not a positive duration, using %s", key, val, defaultVal))
+		return defaultVal
+	}
+	return d
+}
+
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBotCacheFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		size, ttl    string
+		wantSize     int
+		wantTTL      time.Duration
+		wantWarnings int
+	}{
+		{name: "unset", wantSize: 10000, wantTTL: 5 * time.Minute},
+		{name: "valid", size: "50", ttl: "1m", wantSize: 50, wantTTL: time.Minute},
+		{name: "unparsable", size: "10k", ttl: "5 minutes", wantSize: 10000, wantTTL: 5 * time.Minute, wantWarnings: 2},
+		{name: "zero", size: "0", ttl: "0s", wantSize: 10000, wantTTL: 5 * time.Minute, wantWarnings: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BOT_CACHE_SIZE", tt.size)
+			t.Setenv("BOT_CACHE_TTL", tt.ttl)
+			t.Setenv("BOT_CACHE_NEGATIVE_TTL", "")
+
+			cfg := Load()
+			if cfg.BotCacheSize != tt.wantSize {
+				t.Errorf("BotCacheSize = %d, want %d", cfg.BotCacheSize, tt.wantSize)
+			}
+			if cfg.BotCacheTTL != tt.wantTTL {
+				t.Errorf("BotCacheTTL = %s, want %s", cfg.BotCacheTTL, tt.wantTTL)
+			}
+			if len(cfg.Warnings) != tt.wantWarnings {
+				t.Errorf("got warnings %q, want %d", cfg.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestInvalidValuesFallBack(t *testing.T) {
+	t.Setenv("DEDUP_TTL", "bad")
+	t.Setenv("BROADCAST_RATE", "-1")
+	t.Setenv("POLLING_ENABLED", "maybe")
+	t.Setenv("INGRESS_BOT_RATE", "0")
+
+	cfg := Load()
+	if cfg.DedupTTL != 24*time.Hour {
+		t.Errorf("DedupTTL = %s, want the default 24h", cfg.DedupTTL)
+	}
+	if cfg.BroadcastRate != 25 {
+		t.Errorf("BroadcastRate = %g, want the default 25", cfg.BroadcastRate)
+	}
+	if !cfg.PollingEnabled {
+		t.Error("PollingEnabled = false, want the default true")
+	}
+	// 0 disables the ingress limiter, it isn't a bad value
+	if cfg.IngressBotRate != 0 {
+		t.Errorf("IngressBotRate = %g, want 0", cfg.IngressBotRate)
+	}
+	if len(cfg.Warnings) != 3 {
+		t.Errorf("got warnings %q, want 3", cfg.Warnings)
+	}
+}
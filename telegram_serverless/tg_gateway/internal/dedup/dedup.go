@@ -0,0 +1,162 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Deduplicator drops updates Telegram delivers more than once.
+// Redis is shared by every gateway replica; when it is unavailable a bounded
+// per-bot window in memory still catches redeliveries to the same replica.
+type Deduplicator struct {
+	storage    *storage.RedisStorage
+	ttl        time.Duration
+	windowSize int
+	logger     *zap.SugaredLogger
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// claimTTL bounds how long an update stays claimed by a publish that never finishes,
+// e.g. because its gateway died. It outlasts the longest durable publish.
+const claimTTL = 30 * time.Second
+
+// Claim results
+// ClaimResult tells the caller of Claim what to do with an update
+type ClaimResult int
+
+const (
+	Claimed   ClaimResult = iota // the update is new and now claimed by the caller
+	InFlight                     // another request is still publishing the update
+	Duplicate                    // the update was already published
+)
+
+// window remembers the most recent update IDs of a bot, up to the window size
+type window struct {
+	order *list.List            // of *windowEntry, oldest first
+	seen  map[int]*list.Element // by update ID
+}
+
+type windowEntry struct {
+	updateID  int
+	published bool
+}
+
+func NewDeduplicator(storage *storage.RedisStorage, ttl time.Duration, windowSize int, logger *zap.SugaredLogger) *Deduplicator {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	return &Deduplicator{
+		storage:    storage,
+		ttl:        ttl,
+		windowSize: windowSize,
+		logger:     logger,
+		windows:    make(map[string]*window),
+	}
+}
+
+// Claim marks updateID of botID as being published, unless it was already published
+// or another request is publishing it. A claimed update must be released with
+// Published or Forget.
+func (d *Deduplicator) Claim(ctx context.Context, botID string, updateID int) ClaimResult {
+	marker, err := d.storage.ClaimUpdate(ctx, botID, updateID, claimTTL)
+	if err == nil {
+		switch marker {
+		case "":
+			d.remember(botID, updateID, false)
+			return Claimed
+		case storage.UpdatePublishing:
+			return InFlight
+		default:
+			return Duplicate
+		}
+	}
+
+	d.logger.Warn("falling back to in-memory deduplication",
+		zap.String("bot_id", botID),
+		zap.Error(err))
+
+	d.mu.Lock()
+	el, seen := d.windowOf(botID).seen[updateID]
+	published := seen && el.Value.(*windowEntry).published
+	d.mu.Unlock()
+	switch {
+	case !seen:
+		d.remember(botID, updateID, false)
+		return Claimed
+	case published:
+		return Duplicate
+	default:
+		return InFlight
+	}
+}
+
+// Published marks a claimed update as published, so Telegram's redeliveries are dropped
+func (d *Deduplicator) Published(ctx context.Context, botID string, updateID int) {
+	d.remember(botID, updateID, true)
+
+	if err := d.storage.MarkUpdatePublished(ctx, botID, updateID, d.ttl); err != nil {
+		d.logger.Error("failed to mark update as published",
+			zap.String("bot_id", botID),
+			zap.Int("update_id", updateID),
+			zap.Error(err))
+	}
+}
+
+// Forget releases updateID so Telegram's next redelivery is accepted,
+// e.g. after publishing it failed
+func (d *Deduplicator) Forget(ctx context.Context, botID string, updateID int) {
+	d.mu.Lock()
+	if w, ok := d.windows[botID]; ok {
+		if el, ok := w.seen[updateID]; ok {
+			w.order.Remove(el)
+			delete(w.seen, updateID)
+		}
+	}
+	d.mu.Unlock()
+
+	if err := d.storage.ForgetUpdate(ctx, botID, updateID); err != nil {
+		d.logger.Error("failed to forget update",
+			zap.String("bot_id", botID),
+			zap.Int("update_id", updateID),
+			zap.Error(err))
+	}
+}
+
+// remember records updateID in the bot's window, evicting the oldest id once it is full
+func (d *Deduplicator) remember(botID string, updateID int, published bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w := d.windowOf(botID)
+	if el, ok := w.seen[updateID]; ok {
+		el.Value.(*windowEntry).published = published
+		return
+	}
+
+	if w.order.Len() >= d.windowSize {
+		oldest := w.order.Front()
+		w.order.Remove(oldest)
+		delete(w.seen, oldest.Value.(*windowEntry).updateID)
+	}
+	w.seen[updateID] = w.order.PushBack(&windowEntry{updateID: updateID, published: published})
+}
+
+// windowOf returns the bot's window, creating it if needed. d.mu must be held.
+func (d *Deduplicator) windowOf(botID string) *window {
+	w, ok := d.windows[botID]
+	if !ok {
+		w = &window{
+			order: list.New(),
+			seen:  make(map[int]*list.Element, d.windowSize),
+		}
+		d.windows[botID] = w
+	}
+	return w
+}
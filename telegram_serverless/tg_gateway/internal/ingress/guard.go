@@ -0,0 +1,160 @@
+package ingress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	AllowedCIDRs   []string // empty disables the source allowlist
+	TrustedProxies []string // X-Forwarded-For is only honored from these
+	BotRate        float64  // requests per second per bot, 0 disables
+	BotBurst       int
+	IPRate         float64 // requests per second per source IP, 0 disables
+	IPBurst        int
+}
+
+// Guard filters webhook requests before they reach the handler
+type Guard struct {
+	allowed    []*net.IPNet
+	trusted    []*net.IPNet
+	botLimiter *ratelimit.Limiter
+	ipLimiter  *ratelimit.Limiter
+	logger     *zap.SugaredLogger
+}
+
+func NewGuard(cfg Config, logger *zap.SugaredLogger) (*Guard, error) {
+	allowed, err := parseCIDRs(cfg.AllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed cidrs: %w", err)
+	}
+	trusted, err := parseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	g := &Guard{
+		allowed: allowed,
+		trusted: trusted,
+		logger:  logger,
+	}
+	if cfg.BotRate > 0 {
+		g.botLimiter = ratelimit.NewLimiter(cfg.BotRate, cfg.BotBurst)
+	}
+	if cfg.IPRate > 0 {
+		g.ipLimiter = ratelimit.NewLimiter(cfg.IPRate, cfg.IPBurst)
+	}
+
+	return g, nil
+}
+
+// BotLookup resolves the bot a webhook path segment belongs to
+type BotLookup func(ctx context.Context, key string) (*models.BotSettings, error)
+
+// Handler returns the middleware. The bot limiter is keyed by the bot the path segment
+// resolves to, so made-up segments can't create buckets; the webhook handler refuses them.
+// The lookup is served by the registry cache, which the handler then hits again.
+func (g *Guard) Handler(botParam string, lookup BotLookup) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := g.clientIP(c)
+
+		if len(g.allowed) > 0 && !contains(g.allowed, ip) {
+			g.logger.Warn("rejected webhook from outside the allowlist", zap.String("ip", ip.String()))
+			return g.reject(c, fiber.StatusForbidden, "forbidden_ip")
+		}
+
+		if g.ipLimiter != nil && !g.ipLimiter.Allow(ip.String()) {
+			return g.reject(c, fiber.StatusTooManyRequests, "ip_rate_limited")
+		}
+
+		if g.botLimiter != nil {
+			settings, err := lookup(c.UserContext(), c.Params(botParam))
+			if err == nil && !g.botLimiter.Allow(settings.BotID) {
+				return g.reject(c, fiber.StatusTooManyRequests, "bot_rate_limited")
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// ErrorHandler is the server's fiber error handler. It counts the bodies refused for
+// exceeding the body limit, which Fiber rejects before any handler runs.
+func (g *Guard) ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusRequestEntityTooLarge {
+		metrics.IngressRejections.WithLabelValues("body_too_large").Inc()
+	}
+	return fiber.DefaultErrorHandler(c, err)
+}
+
+func (g *Guard) reject(c *fiber.Ctx, status int, reason string) error {
+	metrics.IngressRejections.WithLabelValues(reason).Inc()
+	return c.Status(status).SendString(strings.ReplaceAll(reason, "_", " "))
+}
+
+// clientIP is the connection's address unless it comes from a trusted proxy.
+// Then X-Forwarded-For is walked from the right, skipping trusted hops,
+// because only the entries our own proxies appended can be believed.
+func (g *Guard) clientIP(c *fiber.Ctx) net.IP {
+	ip := c.Context().RemoteIP()
+	if !contains(g.trusted, ip) {
+		return ip
+	}
+
+	hops := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !contains(g.trusted, hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
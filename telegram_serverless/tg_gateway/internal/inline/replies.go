@@ -0,0 +1,180 @@
+package inline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/kafka"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"go.uber.org/zap"
+)
+
+// claimGrace bounds the wait for a reply that was claimed just as the budget ran out;
+// it was published atomically with the claim, so it is already in flight
+const claimGrace = time.Second
+
+// Replies lets webhook requests wait for a worker's reply so it can be returned
+// as the webhook response. Replies reach this replica through its own Redis channel,
+// whichever replica consumed the worker's command.
+type Replies struct {
+	storage    *storage.RedisStorage
+	producer   *kafka.Producer
+	instanceID string
+	logger     *zap.SugaredLogger
+
+	mu      sync.Mutex
+	waiters map[string]chan []byte
+}
+
+func NewReplies(storage *storage.RedisStorage, producer *kafka.Producer, instanceID string, logger *zap.SugaredLogger) *Replies {
+	return &Replies{
+		storage:    storage,
+		producer:   producer,
+		instanceID: instanceID,
+		logger:     logger,
+		waiters:    make(map[string]chan []byte),
+	}
+}
+
+// Start delivers replies to waiting webhooks until ctx is cancelled
+func (r *Replies) Start(ctx context.Context) {
+	for reply := range r.storage.SubscribeInlineReplies(ctx, r.instanceID) {
+		r.mu.Lock()
+		ch, ok := r.waiters[waiterKey(reply.BotID, reply.UpdateID)]
+		r.mu.Unlock()
+
+		if !ok {
+			r.logger.Error("inline reply lost, its webhook already returned",
+				zap.String("bot_id", reply.BotID),
+				zap.Int("update_id", reply.UpdateID))
+			continue
+		}
+
+		select {
+		case ch <- reply.Body:
+		default:
+		}
+	}
+}
+
+// Waiter is a webhook request waiting for the reply to its update
+type Waiter struct {
+	replies  *Replies
+	botID    string
+	updateID int
+	budget   time.Duration
+	ch       chan []byte
+}
+
+// Register starts waiting for the reply to update_id. It has to happen before the
+// update is published, otherwise a fast worker could reply before anyone waits.
+func (r *Replies) Register(ctx context.Context, botID string, updateID int, budget time.Duration) (*Waiter, error) {
+	w := &Waiter{
+		replies:  r,
+		botID:    botID,
+		updateID: updateID,
+		budget:   budget,
+		ch:       make(chan []byte, 1),
+	}
+
+	r.mu.Lock()
+	r.waiters[waiterKey(botID, updateID)] = w.ch
+	r.mu.Unlock()
+
+	// The key outlives the budget so a claim racing with the timeout still finds it
+	if err := r.storage.WaitInlineReply(ctx, botID, updateID, r.instanceID, budget+claimGrace); err != nil {
+		w.release()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Await returns the webhook response body, or nil when no reply came within the budget.
+// The worker's command is then sent through the outgoing topic as usual.
+func (w *Waiter) Await(ctx context.Context) []byte {
+	defer w.release()
+
+	timer := time.NewTimer(w.budget)
+	defer timer.Stop()
+
+	select {
+	case body := <-w.ch:
+		return body
+	case <-timer.C:
+	}
+
+	cancelled, err := w.replies.storage.CancelInlineReply(ctx, w.botID, w.updateID)
+	if err != nil {
+		w.replies.logger.Error("failed to cancel inline reply wait",
+			zap.String("bot_id", w.botID),
+			zap.Error(err))
+	}
+	if cancelled || err != nil {
+		return nil
+	}
+
+	select {
+	case body := <-w.ch:
+		return body
+	case <-time.After(claimGrace):
+		w.replies.logger.Error("claimed inline reply never arrived, sending it through the outgoing topic",
+			zap.String("bot_id", w.botID),
+			zap.Int("update_id", w.updateID))
+		w.resend(ctx)
+		return nil
+	}
+}
+
+// resend publishes the command of a claimed reply that never arrived to the bot's outgoing
+// topic. The worker was told it was answered inline; sending it late beats losing it.
+func (w *Waiter) resend(ctx context.Context) {
+	cmd, err := w.replies.storage.TakeClaimedCommand(ctx, w.botID, w.updateID)
+	if err != nil {
+		w.replies.logger.Error("failed to get claimed command", zap.String("bot_id", w.botID), zap.Error(err))
+		return
+	}
+	if cmd == nil {
+		w.replies.logger.Error("claimed command expired before it could be resent",
+			zap.String("bot_id", w.botID),
+			zap.Int("update_id", w.updateID))
+		return
+	}
+
+	// The webhook is answered by now, the command goes to the Bot API
+	cmd.ReplyToUpdateID = 0
+
+	topic := fmt.Sprintf("bot_%s_outgoing", w.botID)
+	if err := w.replies.producer.PublishDurable(ctx, topic, "", cmd); err != nil {
+		w.replies.logger.Error("failed to resend claimed command",
+			zap.String("bot_id", w.botID),
+			zap.Int("update_id", w.updateID),
+			zap.Error(err))
+	}
+}
+
+// Cancel stops waiting, e.g. when the update was not published after all
+func (w *Waiter) Cancel(ctx context.Context) {
+	w.release()
+	if _, err := w.replies.storage.CancelInlineReply(ctx, w.botID, w.updateID); err != nil {
+		w.replies.logger.Error("failed to cancel inline reply wait",
+			zap.String("bot_id", w.botID),
+			zap.Error(err))
+	}
+}
+
+func (w *Waiter) release() {
+	w.replies.mu.Lock()
+	defer w.replies.mu.Unlock()
+
+	key := waiterKey(w.botID, w.updateID)
+	if w.replies.waiters[key] == w.ch {
+		delete(w.replies.waiters, key)
+	}
+}
+
+func waiterKey(botID string, updateID int) string {
+	return fmt.Sprintf("%s:%d", botID, updateID)
+}
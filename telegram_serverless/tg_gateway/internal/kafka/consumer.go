@@ -2,7 +2,10 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -10,14 +13,16 @@ import (
 )
 
 type Consumer struct {
-	reader *kafka.Reader
-	logger *zap.SugaredLogger
+	reader  *kafka.Reader
+	offsets *offsetTracker
+	logger  *zap.SugaredLogger
 }
 
 func NewConsumer(brokers []string, groupID string, topics []string, logger *zap.SugaredLogger) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        brokers,
 		GroupID:        groupID,
+		GroupTopics:    topics,
 		MinBytes:       10e3,
 		MaxBytes:       10e6,
 		CommitInterval: time.Second,
@@ -25,12 +30,17 @@ func NewConsumer(brokers []string, groupID string, topics []string, logger *zap.
 	})
 
 	return &Consumer{
-		reader: reader,
-		logger: logger,
+		reader:  reader,
+		offsets: newOffsetTracker(),
+		logger:  logger,
 	}
 }
 
-func (c *Consumer) ConsumeMessages(ctx context.Context, handler func(kafka.Message) error) error {
+// ConsumeMessages passes messages to handler, which may finish them in the background
+// and calls done once a message is handled. A message's offset is committed only after
+// it and every earlier message of its partition are done. A handler error counts as done,
+// unless ctx was cancelled meanwhile: the message then stays uncommitted and is read again.
+func (c *Consumer) ConsumeMessages(ctx context.Context, handler func(msg kafka.Message, done func()) error) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -39,8 +49,19 @@ func (c *Consumer) ConsumeMessages(ctx context.Context, handler func(kafka.Messa
 		default:
 			msg, err := c.reader.FetchMessage(ctx)
 			if err != nil {
+				// A closed reader or a cancelled context won't recover, retrying would only spin
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
 				c.logger.Error("failed to fetch message", zap.Error(err))
-				time.Sleep(time.Second)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Second):
+				}
 				continue
 			}
 
@@ -49,20 +70,42 @@ func (c *Consumer) ConsumeMessages(ctx context.Context, handler func(kafka.Messa
 				zap.Int("partition", msg.Partition),
 				zap.Int64("offset", msg.Offset))
 
-			if err := handler(msg); err != nil {
+			c.offsets.fetched(msg)
+			var once sync.Once
+			done := func() {
+				once.Do(func() { c.markDone(msg) })
+			}
+
+			if err := handler(msg, done); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 				c.logger.Error("failed to process message",
 					zap.String("topic", msg.Topic),
 					zap.Int64("offset", msg.Offset),
 					zap.Error(err))
-			}
-
-			if err := c.reader.CommitMessages(ctx, msg); err != nil {
-				c.logger.Error("failed to commit message", zap.Error(err))
+				done()
 			}
 		}
 	}
 }
 
+func (c *Consumer) markDone(msg kafka.Message) {
+	commit, ok := c.offsets.done(msg)
+	if !ok {
+		return
+	}
+
+	// Not bound to the consume context, messages finished during shutdown still get committed
+	if err := c.reader.CommitMessages(context.Background(), commit); err != nil {
+		c.logger.Error("failed to commit message",
+			zap.String("topic", commit.Topic),
+			zap.Int64("offset", commit.Offset),
+			zap.Error(err))
+	}
+}
+
+// Close stops the consumer and flushes pending commits
 func (c *Consumer) Close() error {
 	return c.reader.Close()
 }
@@ -0,0 +1,24 @@
+package kafka
+
+import (
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewConsumerSubscribesToTopics(t *testing.T) {
+	topics := []string{"bot_1_outgoing", "bot_2_outgoing"}
+
+	// A group reader without topics panics, which used to take the gateway down
+	consumer := NewConsumer([]string{"localhost:9092"}, "tg_gateway", topics, zap.NewNop().Sugar())
+	defer consumer.Close()
+
+	config := consumer.reader.Config()
+	if config.GroupID != "tg_gateway" {
+		t.Errorf("GroupID = %q, want %q", config.GroupID, "tg_gateway")
+	}
+	if !slices.Equal(config.GroupTopics, topics) {
+		t.Errorf("GroupTopics = %v, want %v", config.GroupTopics, topics)
+	}
+}
@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker holds back a partition's commit until every message fetched before
+// it is done, so messages finished out of order aren't skipped after a restart
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*pendingOffsets
+}
+
+// pendingOffsets are the fetched offsets of one partition that aren't committed yet
+type pendingOffsets struct {
+	order []int64        // in fetch order, which is ascending
+	done  map[int64]bool // false while the message is in flight
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*pendingOffsets)}
+}
+
+func (t *offsetTracker) fetched(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending, ok := t.partitions[msg.Partition]
+	// After a rebalance the partition starts over from its committed offset; the
+	// messages still in flight will be fetched again
+	if !ok || (len(pending.order) > 0 && msg.Offset <= pending.order[len(pending.order)-1]) {
+		pending = &pendingOffsets{done: make(map[int64]bool)}
+		t.partitions[msg.Partition] = pending
+	}
+
+	pending.order = append(pending.order, msg.Offset)
+	pending.done[msg.Offset] = false
+}
+
+// done marks the message finished and returns the message to commit, if the
+// partition's committed offset can move forward
+func (t *offsetTracker) done(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending, ok := t.partitions[msg.Partition]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	if _, fetched := pending.done[msg.Offset]; !fetched {
+		return kafka.Message{}, false
+	}
+	pending.done[msg.Offset] = true
+
+	commit := int64(-1)
+	for len(pending.order) > 0 && pending.done[pending.order[0]] {
+		commit = pending.order[0]
+		delete(pending.done, commit)
+		pending.order = pending.order[1:]
+	}
+	if commit < 0 {
+		return kafka.Message{}, false
+	}
+
+	return kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: commit}, true
+}
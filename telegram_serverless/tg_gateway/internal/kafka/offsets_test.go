@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	type step struct {
+		fetch     bool // fetched when true, done otherwise
+		partition int
+		offset    int64
+
+		wantCommit bool
+		wantOffset int64
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "in order",
+			steps: []step{
+				{fetch: true, offset: 1},
+				{fetch: true, offset: 2},
+				{offset: 1, wantCommit: true, wantOffset: 1},
+				{offset: 2, wantCommit: true, wantOffset: 2},
+			},
+		},
+		{
+			name: "out of order holds back the commit",
+			steps: []step{
+				{fetch: true, offset: 1},
+				{fetch: true, offset: 2},
+				{fetch: true, offset: 3},
+				{offset: 3},
+				{offset: 2},
+				{offset: 1, wantCommit: true, wantOffset: 3},
+			},
+		},
+		{
+			name: "partitions are independent",
+			steps: []step{
+				{fetch: true, partition: 0, offset: 1},
+				{fetch: true, partition: 1, offset: 1},
+				{partition: 1, offset: 1, wantCommit: true, wantOffset: 1},
+				{partition: 0, offset: 1, wantCommit: true, wantOffset: 1},
+			},
+		},
+		{
+			name: "unknown messages are ignored",
+			steps: []step{
+				{offset: 1},
+				{fetch: true, offset: 2},
+				{offset: 1},
+				{offset: 2, wantCommit: true, wantOffset: 2},
+			},
+		},
+		{
+			name: "refetch after a rebalance starts over",
+			steps: []step{
+				{fetch: true, offset: 1},
+				{fetch: true, offset: 2},
+				{offset: 2},
+				{fetch: true, offset: 1},
+				{offset: 1, wantCommit: true, wantOffset: 1},
+				// Done of the stale fetch of offset 2 must not move the commit past 1
+				{offset: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for i, s := range tt.steps {
+				msg := kafka.Message{Topic: "bot_1_outgoing", Partition: s.partition, Offset: s.offset}
+				if s.fetch {
+					tracker.fetched(msg)
+					continue
+				}
+
+				commit, ok := tracker.done(msg)
+				if ok != s.wantCommit {
+					t.Fatalf("step %d: done(%d/%d) commit = %v, want %v", i, s.partition, s.offset, ok, s.wantCommit)
+				}
+				if ok && (commit.Offset != s.wantOffset || commit.Partition != s.partition || commit.Topic != msg.Topic) {
+					t.Fatalf("step %d: committed %s/%d/%d, want %s/%d/%d", i,
+						commit.Topic, commit.Partition, commit.Offset, msg.Topic, s.partition, s.wantOffset)
+				}
+			}
+		})
+	}
+}
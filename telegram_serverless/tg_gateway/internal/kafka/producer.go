@@ -10,30 +10,63 @@ import (
 	"go.uber.org/zap"
 )
 
+// Producer publishes through two writers. The async one returns before the broker
+// acknowledges the write; the durable one blocks until every replica has it and
+// batches concurrent callers so throughput holds up under load.
 type Producer struct {
-	writer *kafka.Writer
-	logger *zap.SugaredLogger
+	writer        *kafka.Writer
+	durableWriter *kafka.Writer
+	logger        *zap.SugaredLogger
 }
 
-func NewProducer(brokers []string, logger *zap.SugaredLogger) *Producer {
+func NewProducer(brokers []string, batchSize int, batchTimeout time.Duration, logger *zap.SugaredLogger) *Producer {
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     &kafka.Hash{}, // keyed messages stick to a partition, unkeyed ones go round-robin
 		BatchTimeout: 10 * time.Millisecond,
 		RequiredAcks: kafka.RequireAll,
 		Async:        true,
 		Compression:  kafka.Snappy,
 		Logger:       kafka.LoggerFunc(logger.Infof),
 		ErrorLogger:  kafka.LoggerFunc(logger.Errorf),
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				logger.Error("async kafka write failed, messages lost",
+					zap.Int("count", len(messages)),
+					zap.Error(err))
+			}
+		},
+	}
+
+	durableWriter := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		BatchSize:    batchSize,
+		BatchTimeout: batchTimeout,
+		RequiredAcks: kafka.RequireAll,
+		Compression:  kafka.Snappy,
+		Logger:       kafka.LoggerFunc(logger.Infof),
+		ErrorLogger:  kafka.LoggerFunc(logger.Errorf),
 	}
 
 	return &Producer{
-		writer: writer,
-		logger: logger,
+		writer:        writer,
+		durableWriter: durableWriter,
+		logger:        logger,
 	}
 }
 
+// PublishMessage writes value to topic. An empty key spreads messages round-robin.
 func (p *Producer) PublishMessage(ctx context.Context, topic string, key string, value interface{}) error {
+	return p.publish(ctx, p.writer, topic, key, value)
+}
+
+// PublishDurable writes value to topic and returns once all in-sync replicas acknowledged it
+func (p *Producer) PublishDurable(ctx context.Context, topic string, key string, value interface{}) error {
+	return p.publish(ctx, p.durableWriter, topic, key, value)
+}
+
+func (p *Producer) publish(ctx context.Context, writer *kafka.Writer, topic string, key string, value interface{}) error {
 	data, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
@@ -41,12 +74,14 @@ func (p *Producer) PublishMessage(ctx context.Context, topic string, key string,
 
 	msg := kafka.Message{
 		Topic: topic,
-		Key:   []byte(key),
 		Value: data,
 		Time:  time.Now(),
 	}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
 
-	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+	if err := writer.WriteMessages(ctx, msg); err != nil {
 		return fmt.Errorf("failed to write message to kafka: %w", err)
 	}
 
@@ -54,5 +89,9 @@ func (p *Producer) PublishMessage(ctx context.Context, topic string, key string,
 }
 
 func (p *Producer) Close() error {
-	return p.writer.Close()
+	if err := p.writer.Close(); err != nil {
+		p.durableWriter.Close()
+		return err
+	}
+	return p.durableWriter.Close()
 }
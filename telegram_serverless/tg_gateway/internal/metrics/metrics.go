@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// BotCacheLookups counts bot registry lookups by result: hit, negative_hit, miss or stale
+var BotCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_bot_cache_lookups_total",
+	Help: "Bot registry cache lookups by result.",
+}, []string{"result"})
+
+// DuplicateUpdates counts webhook deliveries dropped because the update was already published
+var DuplicateUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_duplicate_updates_total",
+	Help: "Redelivered updates acknowledged without republishing.",
+}, []string{"bot_id"})
+
+// InvalidPolledUpdates counts updates from getUpdates skipped for lacking a readable update_id
+var InvalidPolledUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_invalid_polled_updates_total",
+	Help: "Polled updates skipped because their update_id couldn't be read.",
+}, []string{"bot_id"})
+
+// IngressRejections counts webhook requests refused before processing, by reason:
+// forbidden_ip, bot_rate_limited, ip_rate_limited or body_too_large
+var IngressRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_ingress_rejections_total",
+	Help: "Webhook requests rejected by ingress protection.",
+}, []string{"reason"})
+
+// BroadcastMessages counts broadcast recipients by result: sent, failed or blocked
+var BroadcastMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_broadcast_messages_total",
+	Help: "Broadcast messages by delivery result.",
+}, []string{"result"})
+
+// OutgoingThrottled counts waits for the Bot API sending limits by the limit that was
+// reached: bot, paid, private_chat or group_chat
+var OutgoingThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_outgoing_throttled_total",
+	Help: "Outgoing messages held back by the Bot API rate limits.",
+}, []string{"scope"})
+
+// OutgoingQueued is the number of outgoing commands waiting in per-chat queues
+var OutgoingQueued = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "tg_gateway_outgoing_queued",
+	Help: "Outgoing commands queued behind a throttled chat.",
+})
+
+// OutgoingRetries counts retried Bot API calls by failure: flood, server or network
+var OutgoingRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_outgoing_retries_total",
+	Help: "Outgoing Bot API calls retried after a failure.",
+}, []string{"failure"})
+
+// DeadLetters counts outgoing commands sent to a bot's dead-letter topic
+var DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_dead_letters_total",
+	Help: "Outgoing commands dead-lettered after failing for good.",
+}, []string{"bot_id"})
+
+// OutgoingTokenMismatches counts outgoing commands rejected for carrying another bot's token
+var OutgoingTokenMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tg_gateway_outgoing_token_mismatches_total",
+	Help: "Outgoing commands rejected because their bot token doesn't match the topic's bot.",
+}, []string{"bot_id"})
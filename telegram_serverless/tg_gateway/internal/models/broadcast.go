@@ -0,0 +1,29 @@
+package models
+
+// Broadcast statuses, shared with the manager which creates and controls broadcasts
+const (
+	BroadcastPending   = "pending"
+	BroadcastRunning   = "running"
+	BroadcastPaused    = "paused"
+	BroadcastCancelled = "cancelled"
+	BroadcastCompleted = "completed"
+)
+
+// Broadcast results a recipient is counted under
+const (
+	BroadcastSent    = "sent"
+	BroadcastFailed  = "failed"
+	BroadcastBlocked = "blocked"
+)
+
+// Broadcast is the part of a manager broadcast the gateway needs to deliver it
+type Broadcast struct {
+	ID        string
+	BotID     string
+	Method    string
+	Params    map[string]interface{}
+	Status    string
+	Total     int64
+	Cursor    int64 // index of the next recipient to send to
+	CreatedAt int64
+}
@@ -1,22 +1,9 @@
 package models
 
-import "encoding/json"
-
-type TelegramUpdate struct {
-	UpdateID    int             `json:"update_id"`
-	Message     *Message        `json:"message,omitempty"`
-	Callback    *CallbackQuery  `json:"callback_query,omitempty"`
-	InlineQuery *InlineQuery    `json:"inline_query,omitempty"`
-	Raw         json.RawMessage `json:"-"`
-}
-
-type Message struct {
-	MessageID int    `json:"message_id"`
-	From      *User  `json:"from,omitempty"`
-	Chat      *Chat  `json:"chat"`
-	Date      int64  `json:"date"`
-	Text      string `json:"text,omitempty"`
-}
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
 	ID           int64  `json:"id"`
@@ -36,27 +23,136 @@ type Chat struct {
 	LastName  string `json:"last_name,omitempty"`
 }
 
-type CallbackQuery struct {
-	ID      string   `json:"id"`
-	From    *User    `json:"from"`
-	Message *Message `json:"message,omitempty"`
-	Data    string   `json:"data,omitempty"`
+type OutgoingCommand struct {
+	// BotToken is optional: the gateway sends as the bot of the topic the command was
+	// written to and rejects commands whose token belongs to anything else
+	BotToken string                 `json:"bot_token,omitempty"`
+	Method   string                 `json:"method"`
+	Params   map[string]interface{} `json:"params"`
+	// ReplyToUpdateID lets the gateway answer the webhook of that update with this call
+	// when the bot uses inline replies and the webhook is still waiting
+	ReplyToUpdateID int `json:"reply_to_update_id,omitempty"`
+	// RequestID asks for the outcome to be published to bot_<id>_results, keyed by this id
+	RequestID string `json:"request_id,omitempty"`
+	// Attachments are uploaded as multipart/form-data; params refer to them as attach://<name>
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file sent with a command, either inline or by reference to blob storage
+type Attachment struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data,omitempty"` // base64 in JSON
+	URL         string `json:"url,omitempty"`  // s3://bucket/bots/<bot_id>/key or local://path below the bot's directory
 }
 
-type InlineQuery struct {
-	ID     string `json:"id"`
-	From   *User  `json:"from"`
-	Query  string `json:"query"`
-	Offset string `json:"offset"`
+// CommandResult is the outcome of a command that carried a request_id
+type CommandResult struct {
+	RequestID   string          `json:"request_id"`
+	BotID       string          `json:"bot_id"`
+	Method      string          `json:"method"`
+	Ok          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result,omitempty"`      // the Bot API's result, e.g. the sent Message
+	ErrorCode   int             `json:"error_code,omitempty"`  // Bot API error code, absent for network errors
+	Description string          `json:"description,omitempty"` // why the command failed
+	Inline      bool            `json:"inline,omitempty"`      // sent as a webhook response, which has no result
+	Attempts    int             `json:"attempts"`
+	CompletedAt time.Time       `json:"completed_at"`
 }
 
-type OutgoingCommand struct {
-	BotToken string                 `json:"bot_token"`
-	Method   string                 `json:"method"`
-	Params   map[string]interface{} `json:"params"`
+// DeadLetter is an outgoing command that failed for good, as published to bot_<id>_dlq.
+// The command is stored without its bot token.
+type DeadLetter struct {
+	BotID     string          `json:"bot_id"`
+	Command   OutgoingCommand `json:"command"`
+	Error     string          `json:"error"`
+	ErrorCode int             `json:"error_code,omitempty"` // Bot API error code, absent for network errors
+	Attempts  int             `json:"attempts"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+// InlineReply carries a webhook response body from the replica that consumed the
+// worker's command to the replica holding the webhook request
+type InlineReply struct {
+	BotID    string          `json:"bot_id"`
+	UpdateID int             `json:"update_id"`
+	Body     json.RawMessage `json:"body"`
 }
 
+// IncomingMessage wraps an update exactly as Telegram sent it, or an event raised by the gateway
 type IncomingMessage struct {
-	BotID  string         `json:"bot_id"`
-	Update TelegramUpdate `json:"update"`
+	BotID  string          `json:"bot_id"`
+	Update json.RawMessage `json:"update,omitempty"`
+	Event  *GatewayEvent   `json:"event,omitempty"`
+}
+
+// GatewayEvent tells a worker about something it wouldn't learn from its updates
+type GatewayEvent struct {
+	Type string `json:"type"`
+	// ChatID and MigrateToChatID are set on chat_migrated: the group ChatID was upgraded
+	// to the supergroup MigrateToChatID, commands for ChatID are sent there from now on
+	ChatID          int64     `json:"chat_id,omitempty"`
+	MigrateToChatID int64     `json:"migrate_to_chat_id,omitempty"`
+	OccurredAt      time.Time `json:"occurred_at"`
+}
+
+const GatewayEventChatMigrated = "chat_migrated"
+
+// BotSettings is the gateway's view of a bot registered by the manager
+type BotSettings struct {
+	BotID               string        `json:"bot_id"`
+	BotToken            string        `json:"bot_token"`
+	TelegramAPIURL      string        `json:"telegram_api_url,omitempty"`
+	WebhookID           string        `json:"webhook_id,omitempty"`
+	WebhookSecret       string        `json:"webhook_secret,omitempty"`
+	PartitionStrategy   string        `json:"partition_strategy,omitempty"` // chat (default), user or round_robin
+	DeliveryMode        string        `json:"delivery_mode,omitempty"`      // async or durable, empty means the gateway default
+	Routes              []RoutingRule `json:"routes,omitempty"`
+	IngestionMode       string        `json:"ingestion_mode,omitempty"` // webhook (default) or polling
+	InlineReplies       bool          `json:"inline_replies,omitempty"`
+	InlineReplyBudget   int           `json:"inline_reply_budget_ms,omitempty"` // 0 means the gateway default
+	OutgoingConcurrency int           `json:"outgoing_concurrency,omitempty"`   // 0 means the gateway default
+}
+
+// Ingestion modes
+const (
+	IngestionWebhook = "webhook"
+	IngestionPolling = "polling"
+)
+
+// RoutingRule sends matching updates to bot_<id>_<topic>; every condition that is set has to match
+type RoutingRule struct {
+	Topic         string   `json:"topic"`
+	UpdateTypes   []string `json:"update_types,omitempty"`
+	CommandPrefix string   `json:"command_prefix,omitempty"`
+	ChatTypes     []string `json:"chat_types,omitempty"`
+	TextPattern   string   `json:"text_pattern,omitempty"`
+}
+
+// Delivery modes for publishing incoming updates
+const (
+	DeliveryAsync   = "async"
+	DeliveryDurable = "durable"
+)
+
+// Partition strategies for incoming updates
+const (
+	PartitionByChat     = "chat"
+	PartitionByUser     = "user"
+	PartitionRoundRobin = "round_robin"
+)
+
+// Bot lifecycle event types published by the manager
+const (
+	BotEventCreated      = "created"
+	BotEventUpdated      = "updated"
+	BotEventDeleted      = "deleted"
+	BotEventTokenRotated = "token_rotated"
+)
+
+// BotEvent is a bot registration change announced by the manager
+type BotEvent struct {
+	Type  string `json:"type"`
+	BotID string `json:"bot_id"`
 }
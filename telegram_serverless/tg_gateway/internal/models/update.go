@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// UpdateMeta holds the few fields of an update the gateway routes on.
+// The update itself is forwarded untouched, so unknown update types still reach workers.
+type UpdateMeta struct {
+	UpdateID int
+	// Type is the name of the update's payload field, e.g. "message" or "my_chat_member"
+	Type     string
+	ChatID   int64
+	ChatType string
+	UserID   int64
+	Text     string
+}
+
+// updatePayload covers where Telegram puts the chat and the user across update types
+type updatePayload struct {
+	Chat    *Chat  `json:"chat"`
+	From    *User  `json:"from"`
+	User    *User  `json:"user"`
+	Text    string `json:"text"`
+	Caption string `json:"caption"`
+	Message *struct {
+		Chat *Chat `json:"chat"`
+	} `json:"message"`
+}
+
+// ParseUpdate extracts routing fields from a raw update without re-encoding it
+func ParseUpdate(raw []byte) (*UpdateMeta, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal update: %w", err)
+	}
+
+	rawID, ok := fields["update_id"]
+	if !ok {
+		return nil, errors.New("update_id is missing")
+	}
+
+	meta := &UpdateMeta{}
+	if err := json.Unmarshal(rawID, &meta.UpdateID); err != nil {
+		return nil, fmt.Errorf("invalid update_id: %w", err)
+	}
+
+	// Besides update_id, an update carries exactly one optional field
+	var payloadRaw json.RawMessage
+	for name, value := range fields {
+		if name != "update_id" {
+			meta.Type, payloadRaw = name, value
+			break
+		}
+	}
+
+	var payload updatePayload
+	if meta.Type == "" || json.Unmarshal(payloadRaw, &payload) != nil {
+		return meta, nil
+	}
+
+	switch {
+	case payload.Chat != nil:
+		meta.ChatID, meta.ChatType = payload.Chat.ID, payload.Chat.Type
+	case payload.Message != nil && payload.Message.Chat != nil:
+		meta.ChatID, meta.ChatType = payload.Message.Chat.ID, payload.Message.Chat.Type
+	}
+
+	switch {
+	case payload.From != nil:
+		meta.UserID = payload.From.ID
+	case payload.User != nil:
+		meta.UserID = payload.User.ID
+	}
+
+	meta.Text = payload.Text
+	if meta.Text == "" {
+		meta.Text = payload.Caption
+	}
+
+	return meta, nil
+}
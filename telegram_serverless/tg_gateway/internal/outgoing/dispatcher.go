@@ -0,0 +1,168 @@
+package outgoing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// job is one outgoing command on its way to the Bot API
+type job struct {
+	botID    string
+	settings *models.BotSettings
+	cmd      *models.OutgoingCommand
+	done     func() // lets the consumer commit the command's offset
+
+	attempts  int           // Bot API calls made so far
+	floodWait time.Duration // retry_after waited out so far
+	migrated  bool          // already redirected to the supergroup its group became
+}
+
+// dispatcher queues commands per chat so a throttled or slow chat waits for its turn
+// without holding up the other chats of the bot. Commands of one chat keep their order,
+// while up to the bot's concurrency of chats are sent to in parallel.
+type dispatcher struct {
+	limiter        *ratelimit.SendLimiter
+	botConcurrency int // used when the bot has no concurrency of its own
+	send           func(*job) (retryIn time.Duration, retry bool)
+	logger         *zap.SugaredLogger
+
+	// slots bounds the commands held in memory; once full, consuming pauses
+	slots chan struct{}
+
+	mu      sync.Mutex
+	lanes   map[string][]*job
+	senders map[string]chan struct{} // per bot, one token per call in flight
+	wg      sync.WaitGroup
+}
+
+func newDispatcher(limiter *ratelimit.SendLimiter, maxQueued, botConcurrency int, send func(*job) (time.Duration, bool), logger *zap.SugaredLogger) *dispatcher {
+	if maxQueued < 1 {
+		maxQueued = 1
+	}
+	if botConcurrency < 1 {
+		botConcurrency = 1
+	}
+	return &dispatcher{
+		limiter:        limiter,
+		botConcurrency: botConcurrency,
+		send:           send,
+		logger:         logger,
+		slots:          make(chan struct{}, maxQueued),
+		lanes:          make(map[string][]*job),
+		senders:        make(map[string]chan struct{}),
+	}
+}
+
+// dispatch queues the command behind earlier commands of the same chat
+func (d *dispatcher) dispatch(ctx context.Context, j *job) error {
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	metrics.OutgoingQueued.Inc()
+
+	key := laneKey(j)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	queue, running := d.lanes[key]
+	d.lanes[key] = append(queue, j)
+	if !running {
+		d.wg.Add(1)
+		go d.run(key)
+	}
+	return nil
+}
+
+// run sends a chat's commands one by one and exits once its queue is empty
+func (d *dispatcher) run(key string) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		queue := d.lanes[key]
+		if len(queue) == 0 {
+			delete(d.lanes, key)
+			d.mu.Unlock()
+			return
+		}
+		j := queue[0]
+		d.mu.Unlock()
+
+		if err := d.limiter.Wait(context.Background(), j.botID, j.cmd.Method, j.cmd.Params); err != nil {
+			d.logger.Error("failed to wait for rate limit", zap.String("bot_id", j.botID), zap.Error(err))
+		}
+		d.sendWithRetries(j)
+		j.done()
+
+		d.mu.Lock()
+		d.lanes[key] = d.lanes[key][1:]
+		d.mu.Unlock()
+
+		<-d.slots
+		metrics.OutgoingQueued.Dec()
+	}
+}
+
+// sendWithRetries calls send until the command needs no retry. The bot's concurrency
+// slot is released between attempts, so a throttled chat doesn't hold up the others.
+func (d *dispatcher) sendWithRetries(j *job) {
+	for {
+		release := d.acquire(j)
+		retryIn, retry := d.send(j)
+		release()
+		if !retry {
+			return
+		}
+		time.Sleep(retryIn)
+	}
+}
+
+// acquire blocks while the bot already has as many calls in flight as its concurrency allows
+func (d *dispatcher) acquire(j *job) (release func()) {
+	concurrency := d.botConcurrency
+	if j.settings.OutgoingConcurrency > 0 {
+		concurrency = j.settings.OutgoingConcurrency
+	}
+
+	d.mu.Lock()
+	sender, ok := d.senders[j.botID]
+	// A changed concurrency takes effect for calls started from now on
+	if !ok || cap(sender) != concurrency {
+		sender = make(chan struct{}, concurrency)
+		d.senders[j.botID] = sender
+	}
+	d.mu.Unlock()
+
+	sender <- struct{}{}
+	return func() { <-sender }
+}
+
+// drain waits up to timeout for queued commands to be sent
+func (d *dispatcher) drain(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		d.logger.Warn("outgoing commands still queued at shutdown", zap.Int("queued", len(d.slots)))
+	}
+}
+
+// laneKey orders commands per chat; commands without a chat share one lane per bot
+func laneKey(j *job) string {
+	chatID, _ := ratelimit.ChatKey(j.cmd.Params)
+	return j.botID + ":" + chatID
+}
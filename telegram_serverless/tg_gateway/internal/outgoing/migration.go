@@ -0,0 +1,87 @@
+package outgoing
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// Supergroups and channels have ids below this; only basic groups are ever migrated
+const supergroupIDBound = -1000000000000
+
+// isBasicGroup tells basic groups from private chats, supergroups and channels
+func isBasicGroup(chatID string) bool {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	return err == nil && id < 0 && id > supergroupIDBound
+}
+
+// rewriteMigratedChat points a command for a group that became a supergroup at the supergroup
+func (p *Processor) rewriteMigratedChat(ctx context.Context, botID string, cmd *models.OutgoingCommand) {
+	chatID, ok := ratelimit.ChatKey(cmd.Params)
+	if !ok || !isBasicGroup(chatID) {
+		return
+	}
+
+	newChatID, err := p.storage.MigratedChatID(ctx, botID, chatID)
+	if err != nil {
+		p.logger.Error("failed to look up chat migration", zap.String("bot_id", botID), zap.Error(err))
+		return
+	}
+	if newChatID == "" {
+		return
+	}
+
+	id, err := strconv.ParseInt(newChatID, 10, 64)
+	if err != nil {
+		return
+	}
+	cmd.Params["chat_id"] = id
+}
+
+// migrateChat handles a group that Telegram reports as upgraded: later commands are
+// rewritten, the worker is told through its incoming topic and the command is pointed
+// at the supergroup
+func (p *Processor) migrateChat(j *job, newChatID int64) {
+	ctx := context.Background()
+	oldChatID, _ := ratelimit.ChatKey(j.cmd.Params)
+
+	p.logger.Info("chat migrated to supergroup",
+		zap.String("bot_id", j.botID),
+		zap.String("chat_id", oldChatID),
+		zap.Int64("migrate_to_chat_id", newChatID))
+
+	saved, err := p.storage.SaveChatMigration(ctx, j.botID, oldChatID, strconv.FormatInt(newChatID, 10))
+	if err != nil {
+		p.logger.Error("failed to save chat migration", zap.String("bot_id", j.botID), zap.Error(err))
+	}
+
+	// Only the replica that recorded the migration announces it
+	if saved {
+		oldID, _ := strconv.ParseInt(oldChatID, 10, 64)
+		event := models.IncomingMessage{
+			BotID: j.botID,
+			Event: &models.GatewayEvent{
+				Type:            models.GatewayEventChatMigrated,
+				ChatID:          oldID,
+				MigrateToChatID: newChatID,
+				OccurredAt:      time.Now().UTC(),
+			},
+		}
+
+		// Keyed like the chat's updates, so the event follows them in order
+		topic := fmt.Sprintf("bot_%s_incoming", j.botID)
+		if err := p.producer.PublishDurable(ctx, topic, oldChatID, event); err != nil {
+			p.logger.Error("failed to publish chat migration",
+				zap.String("bot_id", j.botID),
+				zap.String("chat_id", oldChatID),
+				zap.Error(err))
+		}
+	}
+
+	j.cmd.Params["chat_id"] = newChatID
+}
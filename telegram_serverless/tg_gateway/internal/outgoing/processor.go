@@ -3,53 +3,134 @@ package outgoing
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"github.com/uchebnick/telegram-serverless/botapi"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/blob"
 	kafkapkg "github.com/uchebnick/telegram-serverless/tg_gateway/internal/kafka"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ratelimit"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/registry"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/telegram"
 	"go.uber.org/zap"
 )
 
+// Config tunes how outgoing commands are queued and retried
+type Config struct {
+	MaxQueued      int // commands held in memory behind rate limits
+	MaxAttempts    int // calls of a command failing with 5xx or network errors before it is dead-lettered
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	BotConcurrency int           // calls in flight per bot, unless the bot sets its own
+	MaxFloodWait   time.Duration // total retry_after a command waits out before it is dead-lettered
+	// DiscoveryInterval is how often all outgoing topics are listed in case a bot event was missed
+	DiscoveryInterval time.Duration
+}
+
+// subscription is the consumer of one outgoing topic
+type subscription struct {
+	consumer *kafkapkg.Consumer
+	cancel   context.CancelFunc
+}
+
 type Processor struct {
 	brokers        []string
 	groupID        string
 	telegramClient *telegram.Client
+	registry       *registry.Registry
+	storage        *storage.RedisStorage
+	producer       *kafkapkg.Producer
+	blobs          *blob.Store
+	config         Config
 	logger         *zap.SugaredLogger
-	consumers      map[string]*kafkapkg.Consumer
+	consumers      map[string]*subscription
 	mu             sync.RWMutex
 	topicManager   *kafkapkg.TopicManager
+	dispatcher     *dispatcher
 	stopChan       chan struct{}
 }
 
-func NewProcessor(brokers []string, groupID string, telegramClient *telegram.Client, logger *zap.SugaredLogger) *Processor {
-	return &Processor{
+// drainTimeout bounds how long shutdown waits for commands queued behind rate limits
+const drainTimeout = 10 * time.Second
+
+// uploadTimeout bounds a call with attachments, including fetching them from blob
+// storage; it matches the Telegram client's upload timeout
+const uploadTimeout = 5 * time.Minute
+
+func NewProcessor(
+	brokers []string,
+	groupID string,
+	telegramClient *telegram.Client,
+	registry *registry.Registry,
+	storage *storage.RedisStorage,
+	producer *kafkapkg.Producer,
+	blobs *blob.Store,
+	limiter *ratelimit.SendLimiter,
+	config Config,
+	logger *zap.SugaredLogger,
+) *Processor {
+	if config.MaxFloodWait <= 0 {
+		config.MaxFloodWait = 5 * time.Minute
+	}
+	if config.DiscoveryInterval <= 0 {
+		config.DiscoveryInterval = 5 * time.Minute
+	}
+
+	p := &Processor{
 		brokers:        brokers,
 		groupID:        groupID,
 		telegramClient: telegramClient,
+		registry:       registry,
+		storage:        storage,
+		producer:       producer,
+		blobs:          blobs,
+		config:         config,
 		logger:         logger,
-		consumers:      make(map[string]*kafkapkg.Consumer),
+		consumers:      make(map[string]*subscription),
 		topicManager:   kafkapkg.NewTopicManager(brokers, logger),
 		stopChan:       make(chan struct{}),
 	}
+	p.dispatcher = newDispatcher(limiter, config.MaxQueued, config.BotConcurrency, p.send, logger)
+	return p
 }
 
 func (p *Processor) Start(ctx context.Context) error {
-	if err := p.discoverAndSubscribe(ctx); err != nil {
-		return fmt.Errorf("failed to discover topics: %w", err)
+	// Discovery retries periodically, so a broker that is down at startup isn't fatal
+	if err := p.discoverTopics(ctx); err != nil {
+		p.logger.Error("failed to discover topics", zap.Error(err))
 	}
 
+	go p.watchBotEvents(ctx)
 	go p.periodicTopicDiscovery(ctx)
 
 	<-ctx.Done()
 	return nil
 }
 
+// watchBotEvents subscribes to a bot's outgoing topic as soon as the manager
+// announces the bot and unsubscribes once it is deleted
+func (p *Processor) watchBotEvents(ctx context.Context) {
+	for event := range p.storage.SubscribeBotEvents(ctx) {
+		switch event.Type {
+		case models.BotEventCreated:
+			p.subscribe(ctx, outgoingTopic(event.BotID))
+		case models.BotEventDeleted:
+			p.unsubscribe(outgoingTopic(event.BotID))
+		}
+	}
+}
+
+// periodicTopicDiscovery is the safety net for bot events lost while Redis was unreachable
 func (p *Processor) periodicTopicDiscovery(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(p.config.DiscoveryInterval)
 	defer ticker.Stop()
 
 	for {
@@ -57,41 +138,87 @@ func (p *Processor) periodicTopicDiscovery(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if err := p.discoverAndSubscribe(ctx); err != nil {
+			if err := p.discoverTopics(ctx); err != nil {
 				p.logger.Error("failed to rediscover topics", zap.Error(err))
 			}
 		}
 	}
 }
 
-func (p *Processor) discoverAndSubscribe(ctx context.Context) error {
+// discoverTopics consumes every outgoing topic in the cluster and stops consuming topics that are gone
+func (p *Processor) discoverTopics(ctx context.Context) error {
 	topics, err := p.topicManager.GetAllOutgoingTopics(ctx)
 	if err != nil {
 		return err
 	}
 
+	existing := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		existing[topic] = true
+		p.subscribe(ctx, topic)
+	}
+
+	p.mu.RLock()
+	var gone []string
+	for topic := range p.consumers {
+		if !existing[topic] {
+			gone = append(gone, topic)
+		}
+	}
+	p.mu.RUnlock()
+
+	for _, topic := range gone {
+		p.unsubscribe(topic)
+	}
+
+	return nil
+}
+
+func (p *Processor) subscribe(ctx context.Context, topic string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for _, topic := range topics {
-		if _, exists := p.consumers[topic]; !exists {
-			p.logger.Info("subscribing to new topic", zap.String("topic", topic))
+	if _, exists := p.consumers[topic]; exists {
+		return
+	}
+
+	p.logger.Info("subscribing to new topic", zap.String("topic", topic))
 
-			consumer := kafkapkg.NewConsumer(p.brokers, p.groupID, []string{topic}, p.logger)
-			p.consumers[topic] = consumer
+	consumerCtx, cancel := context.WithCancel(ctx)
+	consumer := kafkapkg.NewConsumer(p.brokers, p.groupID, []string{topic}, p.logger)
+	p.consumers[topic] = &subscription{consumer: consumer, cancel: cancel}
 
-			go func(topic string, consumer *kafkapkg.Consumer) {
-				if err := consumer.ConsumeMessages(ctx, p.handleMessage); err != nil {
-					p.logger.Error("consumer error", zap.String("topic", topic), zap.Error(err))
-				}
-			}(topic, consumer)
+	go func() {
+		handler := func(msg kafka.Message, done func()) error {
+			return p.handleMessage(consumerCtx, msg, done)
+		}
+		if err := consumer.ConsumeMessages(consumerCtx, handler); err != nil && consumerCtx.Err() == nil {
+			p.logger.Error("consumer error", zap.String("topic", topic), zap.Error(err))
 		}
+	}()
+}
+
+func (p *Processor) unsubscribe(topic string) {
+	p.mu.Lock()
+	sub, exists := p.consumers[topic]
+	delete(p.consumers, topic)
+	p.mu.Unlock()
+
+	if !exists {
+		return
 	}
 
-	return nil
+	p.logger.Info("unsubscribing from topic", zap.String("topic", topic))
+
+	sub.cancel()
+	if err := sub.consumer.Close(); err != nil {
+		p.logger.Error("failed to close consumer", zap.String("topic", topic), zap.Error(err))
+	}
 }
 
-func (p *Processor) handleMessage(msg kafka.Message) error {
+// handleMessage hands the command to the dispatcher; done is called once it is sent or dead-lettered.
+// It returns ctx's error if the consumer stops first, leaving the command uncommitted.
+func (p *Processor) handleMessage(ctx context.Context, msg kafka.Message, done func()) error {
 	var cmd models.OutgoingCommand
 	if err := json.Unmarshal(msg.Value, &cmd); err != nil {
 		return fmt.Errorf("failed to unmarshal command: %w", err)
@@ -101,19 +228,267 @@ func (p *Processor) handleMessage(msg kafka.Message) error {
 		zap.String("method", cmd.Method),
 		zap.String("topic", msg.Topic))
 
-	result, err := p.telegramClient.CallMethod(cmd.BotToken, cmd.Method, cmd.Params)
+	botID := botIDFromTopic(msg.Topic)
+	settings, err := p.settings(ctx, botID)
 	if err != nil {
-		p.logger.Error("failed to call telegram handlers",
+		return fmt.Errorf("failed to get bot settings for %s: %w", botID, err)
+	}
+
+	// The topic decides which bot sends, so a worker can't act as another bot
+	if cmd.BotToken != "" && cmd.BotToken != settings.BotToken {
+		metrics.OutgoingTokenMismatches.WithLabelValues(botID).Inc()
+		p.logger.Warn("rejecting outgoing command with a foreign bot token",
+			zap.String("bot_id", botID),
 			zap.String("method", cmd.Method),
+			zap.Int64("offset", msg.Offset))
+		p.publishResult(botID, &cmd, &models.CommandResult{
+			ErrorCode:   401,
+			Description: "Unauthorized: bot_token doesn't belong to the bot of this topic",
+		})
+		done()
+		return nil
+	}
+	cmd.BotToken = ""
+
+	p.rewriteMigratedChat(ctx, botID, &cmd)
+
+	// A webhook response can't carry uploads
+	inline := cmd.ReplyToUpdateID != 0 && settings.InlineReplies && len(cmd.Attachments) == 0
+	if inline && p.replyInline(botID, &cmd) {
+		p.publishResult(botID, &cmd, &models.CommandResult{Ok: true, Inline: true})
+		done()
+		return nil
+	}
+
+	// Blocks only when too many commands are already queued behind rate limits
+	return p.dispatcher.dispatch(ctx, &job{
+		botID:    botID,
+		settings: settings,
+		cmd:      &cmd,
+		done:     done,
+	})
+}
+
+// settings looks up the bot, retrying with backoff while the registry can't be reached.
+// Only a bot that doesn't exist fails for good: its commands have no one to send them.
+func (p *Processor) settings(ctx context.Context, botID string) (*models.BotSettings, error) {
+	for attempt := 1; ; attempt++ {
+		settings, err := p.registry.ByBotID(ctx, botID)
+		if err == nil || errors.Is(err, storage.ErrNotFound) {
+			return settings, err
+		}
+
+		delay := backoff(attempt, p.config.RetryBaseDelay, p.config.RetryMaxDelay)
+		p.logger.Warn("failed to get bot settings, retrying",
+			zap.String("bot_id", botID),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
 			zap.Error(err))
-		return err
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
 	}
+}
 
-	p.logger.Debug("telegram handlers call successful",
-		zap.String("method", cmd.Method),
-		zap.ByteString("result", result))
+// send makes one Bot API call for the command once its rate limits allowed it and
+// returns the delay before the next attempt if it is to be retried. Flood limits are
+// waited out up to MaxFloodWait and transient failures retried; commands that can't
+// succeed are dead-lettered.
+func (p *Processor) send(j *job) (retryIn time.Duration, retry bool) {
+	client := p.telegramClient.WithBaseURL(j.settings.TelegramAPIURL)
 
-	return nil
+	j.attempts++
+	result, err := p.call(client, j)
+	if err == nil {
+		p.logger.Debug("telegram handlers call successful",
+			zap.String("method", j.cmd.Method),
+			zap.ByteString("result", result))
+		p.publishResult(j.botID, j.cmd, &models.CommandResult{Ok: true, Result: result, Attempts: j.attempts})
+		return 0, false
+	}
+
+	// The group became a supergroup; send there right away
+	var tgErr *botapi.Error
+	if errors.As(err, &tgErr) && tgErr.MigrateToChatID != 0 && !j.migrated {
+		p.migrateChat(j, tgErr.MigrateToChatID)
+		j.migrated = true
+		return 0, true
+	}
+
+	class, delay := classify(err)
+	switch {
+	case class == failurePermanent:
+		p.deadLetter(j, err, j.attempts)
+		return 0, false
+	case class == failureFlood:
+		// A chat that stays throttled this long would only keep its lane waiting
+		if j.floodWait+delay > p.config.MaxFloodWait {
+			p.deadLetter(j, err, j.attempts)
+			return 0, false
+		}
+		j.floodWait += delay
+	default:
+		if j.attempts >= p.config.MaxAttempts {
+			p.deadLetter(j, err, j.attempts)
+			return 0, false
+		}
+		delay = backoff(j.attempts, p.config.RetryBaseDelay, p.config.RetryMaxDelay)
+	}
+
+	metrics.OutgoingRetries.WithLabelValues(class).Inc()
+	p.logger.Warn("telegram handlers call failed, retrying",
+		zap.String("bot_id", j.botID),
+		zap.String("method", j.cmd.Method),
+		zap.Int("attempt", j.attempts),
+		zap.Duration("delay", delay),
+		zap.Error(err))
+	return delay, true
+}
+
+// call makes one Bot API call for the command. Attachments are opened again on every
+// attempt since a failed upload may have consumed them.
+func (p *Processor) call(client *telegram.Client, j *job) ([]byte, error) {
+	if len(j.cmd.Attachments) == 0 {
+		return client.CallMethod(j.settings.BotToken, j.cmd.Method, j.cmd.Params)
+	}
+
+	// Bounds the attachment downloads that stream into the upload along with it
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	files := make([]botapi.InputFile, 0, len(j.cmd.Attachments))
+	var contents []io.Closer
+	defer func() {
+		for _, c := range contents {
+			c.Close()
+		}
+	}()
+
+	for _, att := range j.cmd.Attachments {
+		if att.Name == "" {
+			return nil, fmt.Errorf("%w: attachment without a name", blob.ErrInvalidAttachment)
+		}
+
+		content, err := p.blobs.Open(ctx, j.botID, att)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+		files = append(files, botapi.InputFile{
+			Field:       att.Name,
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			Reader:      content,
+		})
+	}
+
+	return client.CallMethodMultipart(ctx, j.settings.BotToken, j.cmd.Method, j.cmd.Params, files)
+}
+
+// deadLetter publishes a command that failed for good to bot_<id>_dlq
+func (p *Processor) deadLetter(j *job, err error, attempts int) {
+	letter := models.DeadLetter{
+		BotID:    j.botID,
+		Command:  *j.cmd,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	var tgErr *botapi.Error
+	if errors.As(err, &tgErr) {
+		letter.ErrorCode = tgErr.ErrorCode
+	}
+
+	p.publishResult(j.botID, j.cmd, &models.CommandResult{
+		ErrorCode:   letter.ErrorCode,
+		Description: letter.Error,
+		Attempts:    attempts,
+	})
+
+	metrics.DeadLetters.WithLabelValues(j.botID).Inc()
+	p.logger.Error("outgoing command failed, dead-lettered",
+		zap.String("bot_id", j.botID),
+		zap.String("method", j.cmd.Method),
+		zap.Int("attempts", attempts),
+		zap.Error(err))
+
+	key, _ := ratelimit.ChatKey(j.cmd.Params)
+	topic := fmt.Sprintf("bot_%s_dlq", j.botID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.producer.PublishDurable(ctx, topic, key, letter); err != nil {
+		p.logger.Error("failed to publish dead letter, command lost",
+			zap.String("bot_id", j.botID),
+			zap.String("topic", topic),
+			zap.Error(err))
+	}
+}
+
+// publishResult tells the worker how a command with a request_id ended, through bot_<id>_results
+func (p *Processor) publishResult(botID string, cmd *models.OutgoingCommand, result *models.CommandResult) {
+	if cmd.RequestID == "" {
+		return
+	}
+
+	result.RequestID = cmd.RequestID
+	result.BotID = botID
+	result.Method = cmd.Method
+	result.CompletedAt = time.Now().UTC()
+
+	topic := fmt.Sprintf("bot_%s_results", botID)
+	if err := p.producer.PublishMessage(context.Background(), topic, cmd.RequestID, result); err != nil {
+		p.logger.Error("failed to publish command result",
+			zap.String("bot_id", botID),
+			zap.String("request_id", cmd.RequestID),
+			zap.Error(err))
+	}
+}
+
+// replyInline hands the command to the webhook of its update if that is still waiting.
+// It returns false when the command has to be sent to the Bot API instead.
+func (p *Processor) replyInline(botID string, cmd *models.OutgoingCommand) bool {
+	body := make(map[string]interface{}, len(cmd.Params)+1)
+	for k, v := range cmd.Params {
+		body[k] = v
+	}
+	body["method"] = cmd.Method
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		p.logger.Error("failed to marshal inline reply", zap.Error(err))
+		return false
+	}
+
+	delivered, err := p.storage.ClaimInlineReply(context.Background(), &models.InlineReply{
+		BotID:    botID,
+		UpdateID: cmd.ReplyToUpdateID,
+		Body:     data,
+	}, cmd)
+	if err != nil {
+		p.logger.Error("failed to claim inline reply", zap.String("bot_id", botID), zap.Error(err))
+		return false
+	}
+
+	if delivered {
+		p.logger.Debug("command answered inline",
+			zap.String("bot_id", botID),
+			zap.String("method", cmd.Method),
+			zap.Int("update_id", cmd.ReplyToUpdateID))
+	}
+	return delivered
+}
+
+func outgoingTopic(botID string) string {
+	return fmt.Sprintf("bot_%s_outgoing", botID)
+}
+
+// botIDFromTopic extracts the bot ID from a bot_<id>_outgoing topic name
+func botIDFromTopic(topic string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(topic, "bot_"), "_outgoing")
 }
 
 func (p *Processor) Stop() {
@@ -122,9 +497,17 @@ func (p *Processor) Stop() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for topic, consumer := range p.consumers {
+	for _, sub := range p.consumers {
+		sub.cancel()
+	}
+
+	// Queued commands aren't committed yet; whatever doesn't make it before the
+	// timeout is consumed again after a restart
+	p.dispatcher.drain(drainTimeout)
+
+	for topic, sub := range p.consumers {
 		p.logger.Info("closing consumer", zap.String("topic", topic))
-		if err := consumer.Close(); err != nil {
+		if err := sub.consumer.Close(); err != nil {
 			p.logger.Error("failed to close consumer", zap.String("topic", topic), zap.Error(err))
 		}
 	}
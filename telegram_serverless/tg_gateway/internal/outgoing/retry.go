@@ -0,0 +1,54 @@
+package outgoing
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/botapi"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/blob"
+)
+
+// Failure classes of a Bot API call
+const (
+	failureFlood     = "flood"     // 429, retried after retry_after
+	failureServer    = "server"    // 5xx, retried with backoff
+	failureNetwork   = "network"   // no answer from the Bot API, retried with backoff
+	failurePermanent = "permanent" // any other 4xx or a broken attachment, dead-lettered right away
+)
+
+// classify tells how a failed Bot API call should be handled
+func classify(err error) (class string, retryAfter time.Duration) {
+	if errors.Is(err, blob.ErrInvalidAttachment) {
+		return failurePermanent, 0
+	}
+
+	var tgErr *botapi.Error
+	if !errors.As(err, &tgErr) {
+		return failureNetwork, 0
+	}
+
+	switch {
+	case tgErr.ErrorCode == 429:
+		return failureFlood, time.Duration(max(tgErr.RetryAfter, 1)) * time.Second
+	case tgErr.ErrorCode >= 500:
+		return failureServer, 0
+	default:
+		return failurePermanent, 0
+	}
+}
+
+// backoff returns the delay before retry number attempt: exponential from base,
+// capped at maxDelay, with jitter so replicas don't retry in lockstep
+func backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if shift := attempt - 1; shift < 32 {
+		delay = min(base<<shift, maxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
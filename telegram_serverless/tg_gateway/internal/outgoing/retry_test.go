@@ -0,0 +1,90 @@
+package outgoing
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/botapi"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/blob"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantClass      string
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:           "flood",
+			err:            &botapi.Error{ErrorCode: 429, RetryAfter: 7},
+			wantClass:      failureFlood,
+			wantRetryAfter: 7 * time.Second,
+		},
+		{
+			name:           "flood without retry_after",
+			err:            &botapi.Error{ErrorCode: 429},
+			wantClass:      failureFlood,
+			wantRetryAfter: time.Second,
+		},
+		{
+			name:           "wrapped flood",
+			err:            fmt.Errorf("failed to send: %w", &botapi.Error{ErrorCode: 429, RetryAfter: 3}),
+			wantClass:      failureFlood,
+			wantRetryAfter: 3 * time.Second,
+		},
+		{name: "server", err: &botapi.Error{ErrorCode: 502}, wantClass: failureServer},
+		{name: "bad request", err: &botapi.Error{ErrorCode: 400}, wantClass: failurePermanent},
+		{name: "blocked", err: &botapi.Error{ErrorCode: 403}, wantClass: failurePermanent},
+		{name: "network", err: errors.New("connection refused"), wantClass: failureNetwork},
+		{
+			name:      "broken attachment",
+			err:       fmt.Errorf("%w: s3://b/k returned status 404", blob.ErrInvalidAttachment),
+			wantClass: failurePermanent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, retryAfter := classify(tt.err)
+			if class != tt.wantClass || retryAfter != tt.wantRetryAfter {
+				t.Errorf("classify() = %s, %s, want %s, %s", class, retryAfter, tt.wantClass, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	const (
+		base     = 500 * time.Millisecond
+		maxDelay = 30 * time.Second
+	)
+
+	tests := []struct {
+		name    string
+		attempt int
+		want    time.Duration // before jitter, which keeps it within [want/2, want]
+	}{
+		{name: "first retry", attempt: 1, want: base},
+		{name: "doubles", attempt: 3, want: 4 * base},
+		{name: "capped", attempt: 10, want: maxDelay},
+		{name: "shift overflow", attempt: 100, want: maxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				delay := backoff(tt.attempt, base, maxDelay)
+				if delay < tt.want/2 || delay > tt.want {
+					t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, delay, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+
+	if delay := backoff(1, 0, maxDelay); delay != 0 {
+		t.Errorf("backoff with zero base = %s, want 0", delay)
+	}
+}
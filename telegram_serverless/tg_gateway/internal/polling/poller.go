@@ -0,0 +1,277 @@
+package polling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/registry"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/telegram"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	// pollTimeout stays below the telegram client's 30s http timeout
+	pollTimeout = 25 * time.Second
+	// errorBackoff is the pause after a failed poll or publish
+	errorBackoff = 5 * time.Second
+)
+
+// Manager polls getUpdates for bots in polling mode. Each bot is polled by
+// exactly one gateway replica, the one holding the bot's lease in Redis.
+type Manager struct {
+	storage      *storage.RedisStorage
+	registry     *registry.Registry
+	handler      *webhook.Handler
+	tgClient     *telegram.Client
+	owner        string
+	leaseTTL     time.Duration
+	syncInterval time.Duration
+	logger       *zap.SugaredLogger
+
+	mu      sync.Mutex
+	pollers map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewManager(
+	storage *storage.RedisStorage,
+	registry *registry.Registry,
+	handler *webhook.Handler,
+	tgClient *telegram.Client,
+	owner string,
+	leaseTTL time.Duration,
+	syncInterval time.Duration,
+	logger *zap.SugaredLogger,
+) *Manager {
+	return &Manager{
+		storage:      storage,
+		registry:     registry,
+		handler:      handler,
+		tgClient:     tgClient,
+		owner:        owner,
+		leaseTTL:     leaseTTL,
+		syncInterval: syncInterval,
+		logger:       logger,
+		pollers:      make(map[string]context.CancelFunc),
+	}
+}
+
+// Start claims polling bots until ctx is cancelled, then waits for pollers to release their leases
+func (m *Manager) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		m.sync(ctx)
+
+		select {
+		case <-ctx.Done():
+			m.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync starts a poller for every polling bot whose lease is free
+func (m *Manager) sync(ctx context.Context) {
+	botIDs, err := m.storage.ListBotIDs(ctx)
+	if err != nil {
+		m.logger.Error("failed to list bots for polling", zap.Error(err))
+		return
+	}
+
+	for _, botID := range botIDs {
+		if m.running(botID) {
+			continue
+		}
+
+		settings, err := m.registry.ByBotID(ctx, botID)
+		if err != nil || settings.IngestionMode != models.IngestionPolling {
+			continue
+		}
+
+		acquired, err := m.storage.AcquireLease(ctx, leaseKey(botID), m.owner, m.leaseTTL)
+		if err != nil {
+			m.logger.Error("failed to acquire poll lease", zap.String("bot_id", botID), zap.Error(err))
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		m.startPoller(ctx, botID)
+	}
+}
+
+func (m *Manager) running(botID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.pollers[botID]
+	return ok
+}
+
+func (m *Manager) startPoller(ctx context.Context, botID string) {
+	pollCtx, cancel := context.WithCancel(ctx)
+
+	m.mu.Lock()
+	m.pollers[botID] = cancel
+	m.mu.Unlock()
+
+	m.logger.Info("polling bot", zap.String("bot_id", botID))
+
+	m.wg.Add(2)
+	go func() {
+		defer m.wg.Done()
+		m.keepLease(pollCtx, cancel, botID)
+	}()
+	go func() {
+		defer m.wg.Done()
+		defer m.stopPoller(botID)
+		m.poll(pollCtx, botID)
+	}()
+}
+
+func (m *Manager) stopPoller(botID string) {
+	m.mu.Lock()
+	cancel, ok := m.pollers[botID]
+	delete(m.pollers, botID)
+	m.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+
+	// The parent context may be gone already, releasing must still reach Redis
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+	if err := m.storage.ReleaseLease(ctx, leaseKey(botID), m.owner); err != nil {
+		m.logger.Error("failed to release poll lease", zap.String("bot_id", botID), zap.Error(err))
+	}
+
+	m.logger.Info("stopped polling bot", zap.String("bot_id", botID))
+}
+
+// keepLease renews the lease at a third of its ttl and stops the poller once it is lost.
+// While Redis is unreachable the lease may expire and another replica take the bot
+// over, so the poller also stops once renewals have failed for longer than the ttl.
+func (m *Manager) keepLease(ctx context.Context, cancel context.CancelFunc, botID string) {
+	ticker := time.NewTicker(m.leaseTTL / 3)
+	defer ticker.Stop()
+
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewed, err := m.storage.RenewLease(ctx, leaseKey(botID), m.owner, m.leaseTTL)
+		if err != nil {
+			m.logger.Error("failed to renew poll lease", zap.String("bot_id", botID), zap.Error(err))
+			if time.Since(renewedAt) >= m.leaseTTL {
+				m.logger.Warn("poll lease expired while it couldn't be renewed", zap.String("bot_id", botID))
+				cancel()
+				return
+			}
+			continue
+		}
+		if !renewed {
+			m.logger.Warn("poll lease lost", zap.String("bot_id", botID))
+			cancel()
+			return
+		}
+		renewedAt = time.Now()
+	}
+}
+
+// poll runs getUpdates until the bot leaves polling mode or the lease is lost.
+// The offset is stored after the batch was durably published, so a crash replays
+// the batch and deduplication drops what was already published.
+func (m *Manager) poll(ctx context.Context, botID string) {
+	offset, err := m.storage.GetPollOffset(ctx, botID)
+	if err != nil {
+		m.logger.Error("failed to get poll offset", zap.String("bot_id", botID), zap.Error(err))
+		return
+	}
+
+	for ctx.Err() == nil {
+		settings, err := m.registry.ByBotID(ctx, botID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return
+		}
+		if err != nil {
+			m.logger.Error("failed to resolve polled bot", zap.String("bot_id", botID), zap.Error(err))
+			sleep(ctx, errorBackoff)
+			continue
+		}
+		if settings.IngestionMode != models.IngestionPolling {
+			return
+		}
+
+		// A failed batch still moves the offset past the updates published before the failure
+		next, pollErr := m.pollOnce(ctx, settings, offset)
+		if next != offset {
+			offset = next
+			if err := m.storage.SavePollOffset(ctx, botID, offset); err != nil {
+				m.logger.Error("failed to save poll offset", zap.String("bot_id", botID), zap.Error(err))
+			}
+		}
+
+		if pollErr != nil && ctx.Err() == nil {
+			m.logger.Error("failed to poll updates", zap.String("bot_id", botID), zap.Error(pollErr))
+			sleep(ctx, errorBackoff)
+		}
+	}
+}
+
+// pollOnce publishes one getUpdates batch and returns the offset after the last published update
+func (m *Manager) pollOnce(ctx context.Context, settings *models.BotSettings, offset int) (int, error) {
+	client := m.tgClient.WithBaseURL(settings.TelegramAPIURL)
+
+	updates, err := client.GetUpdates(ctx, settings.BotToken, offset, pollTimeout)
+	if err != nil {
+		return offset, err
+	}
+
+	for _, raw := range updates {
+		update, err := models.ParseUpdate(raw)
+		if err != nil {
+			// Retrying would fetch the same update forever. Update ids are sequential, so
+			// the unreadable update most likely holds the offset's id; skip past it.
+			metrics.InvalidPolledUpdates.WithLabelValues(settings.BotID).Inc()
+			m.logger.Error("skipped invalid update from getUpdates",
+				zap.String("bot_id", settings.BotID),
+				zap.Int("offset", offset),
+				zap.Error(err))
+			offset++
+			continue
+		}
+
+		if err := m.handler.Ingest(ctx, settings, raw); err != nil {
+			return offset, err
+		}
+		offset = update.UpdateID + 1
+	}
+
+	return offset, nil
+}
+
+func leaseKey(botID string) string {
+	return fmt.Sprintf("bot:poller:%s", botID)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
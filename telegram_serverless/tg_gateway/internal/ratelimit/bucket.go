@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that refilled completely are dropped
+const sweepInterval = time.Minute
+
+// Limiter keeps one token bucket per key, e.g. per bot or per source IP
+type Limiter struct {
+	rate  float64 // tokens added per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket and reports whether one was available
+func (l *Limiter) Allow(key string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops buckets that are full again, they behave exactly like new ones
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Limits are the Bot API sending limits, in messages per second
+type Limits struct {
+	BotRate         float64 // all chats of a bot together
+	PaidRate        float64 // messages sent with allow_paid_broadcast, paid per message
+	PrivateChatRate float64
+	GroupChatRate   float64
+}
+
+// SendLimiter keeps a bot's messages within Telegram's limits across all gateway
+// replicas, so they aren't answered with 429 Too Many Requests
+type SendLimiter struct {
+	storage *storage.RedisStorage
+	limits  Limits
+	logger  *zap.SugaredLogger
+}
+
+func NewSendLimiter(storage *storage.RedisStorage, limits Limits, logger *zap.SugaredLogger) *SendLimiter {
+	return &SendLimiter{
+		storage: storage,
+		limits:  limits,
+		logger:  logger,
+	}
+}
+
+// Wait blocks until the bot may send method with params. Methods that don't send
+// messages aren't limited. If Redis is unavailable the message isn't held back.
+func (l *SendLimiter) Wait(ctx context.Context, botID, method string, params map[string]interface{}) error {
+	buckets, scopes := l.buckets(botID, method, params)
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	for {
+		wait, limited, err := l.storage.TakeToken(ctx, buckets)
+		if err != nil {
+			l.logger.Error("rate limiter unavailable, sending unthrottled",
+				zap.String("bot_id", botID),
+				zap.Error(err))
+			return nil
+		}
+		if wait == 0 {
+			return nil
+		}
+
+		metrics.OutgoingThrottled.WithLabelValues(scopes[limited]).Inc()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// buckets returns the buckets a message takes a token from, along with their metric scope
+func (l *SendLimiter) buckets(botID, method string, params map[string]interface{}) ([]storage.TokenBucket, []string) {
+	if !sendsMessage(method) {
+		return nil, nil
+	}
+
+	var buckets []storage.TokenBucket
+	var scopes []string
+
+	// A rate of 0 turns that limit off
+	add := func(scope, key string, rate, burst float64) {
+		if rate > 0 {
+			buckets = append(buckets, storage.TokenBucket{Key: key, Rate: rate, Burst: max(1, int(burst))})
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if paid, _ := params["allow_paid_broadcast"].(bool); paid {
+		add("paid", fmt.Sprintf("bot:ratelimit:%s:paid", botID), l.limits.PaidRate, l.limits.PaidRate)
+	} else {
+		add("bot", fmt.Sprintf("bot:ratelimit:%s", botID), l.limits.BotRate, l.limits.BotRate)
+	}
+
+	if chatID, ok := ChatKey(params); ok {
+		key := fmt.Sprintf("bot:ratelimit:%s:chat:%s", botID, chatID)
+		if isPrivateChat(chatID) {
+			add("private_chat", key, l.limits.PrivateChatRate, 1)
+		} else {
+			// Groups get a minute's worth of messages as burst
+			add("group_chat", key, l.limits.GroupChatRate, l.limits.GroupChatRate*60)
+		}
+	}
+
+	return buckets, scopes
+}
+
+// ChatKey returns the chat_id parameter of a method call as a string, whether it
+// was given as a number or as a @channel username
+func ChatKey(params map[string]interface{}) (string, bool) {
+	switch v := params["chat_id"].(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case int:
+		return strconv.Itoa(v), true
+	case string:
+		return v, v != ""
+	default:
+		return "", false
+	}
+}
+
+// isPrivateChat tells users, who have positive ids, from groups and channels
+func isPrivateChat(chatID string) bool {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	return err == nil && id > 0
+}
+
+// sendsMessage reports whether a method posts a new message, which is what Telegram limits
+func sendsMessage(method string) bool {
+	switch method {
+	case "sendChatAction":
+		return false
+	case "forwardMessage", "forwardMessages", "copyMessage", "copyMessages":
+		return true
+	}
+	return strings.HasPrefix(method, "send")
+}
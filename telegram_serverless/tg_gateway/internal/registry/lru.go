@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+)
+
+// lruEntry caches one lookup. A nil settings value is a negative entry for an unknown key.
+type lruEntry struct {
+	key       string
+	settings  *models.BotSettings
+	expiresAt time.Time
+}
+
+// lru is a size-bounded cache of bot lookups with an index by bot ID,
+// so every key that resolved to a bot can be dropped at once
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+	byBot    map[string]map[string]struct{}
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		byBot:    make(map[string]map[string]struct{}),
+	}
+}
+
+// get returns the entry for key, including expired ones so callers can fall back to them
+func (c *lru) get(key string) (lruEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return lruEntry{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	return *elem.Value.(*lruEntry), true
+}
+
+func (c *lru) add(key string, settings *models.BotSettings, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+
+	entry := &lruEntry{
+		key:       key,
+		settings:  settings,
+		expiresAt: time.Now().Add(ttl),
+	}
+	c.items[key] = c.order.PushFront(entry)
+
+	if settings != nil {
+		keys, ok := c.byBot[settings.BotID]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.byBot[settings.BotID] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// removeBot drops every key that resolved to botID
+func (c *lru) removeBot(botID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.byBot[botID] {
+		if elem, ok := c.items[key]; ok {
+			c.removeElement(elem)
+		}
+	}
+}
+
+// removeNegative drops all negative entries, e.g. after a bot was created
+func (c *lru) removeNegative() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.items {
+		if elem.Value.(*lruEntry).settings == nil {
+			c.removeElement(elem)
+		}
+	}
+}
+
+func (c *lru) removeElement(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	c.order.Remove(elem)
+	delete(c.items, entry.key)
+
+	if entry.settings != nil {
+		if keys, ok := c.byBot[entry.settings.BotID]; ok {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(c.byBot, entry.settings.BotID)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Registry resolves bots by token, webhook ID or bot ID. Lookups go through an
+// in-process LRU cache backed by Redis that the manager's bot events invalidate.
+type Registry struct {
+	storage     *storage.RedisStorage
+	cache       *lru
+	ttl         time.Duration
+	negativeTTL time.Duration
+	logger      *zap.SugaredLogger
+}
+
+func NewRegistry(storage *storage.RedisStorage, size int, ttl, negativeTTL time.Duration, logger *zap.SugaredLogger) *Registry {
+	return &Registry{
+		storage:     storage,
+		cache:       newLRU(size),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		logger:      logger,
+	}
+}
+
+// ByToken resolves a bot by its Telegram token
+func (r *Registry) ByToken(ctx context.Context, token string) (*models.BotSettings, error) {
+	return r.lookup(ctx, "token:"+token, func(ctx context.Context) (*models.BotSettings, error) {
+		botID, err := r.storage.GetBotIDByToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return r.storage.GetBotSettings(ctx, botID)
+	})
+}
+
+// ByWebhookID resolves a bot by the opaque segment of its webhook path
+func (r *Registry) ByWebhookID(ctx context.Context, webhookID string) (*models.BotSettings, error) {
+	return r.lookup(ctx, "webhook:"+webhookID, func(ctx context.Context) (*models.BotSettings, error) {
+		botID, err := r.storage.GetBotIDByWebhookID(ctx, webhookID)
+		if err != nil {
+			return nil, err
+		}
+		return r.storage.GetBotSettings(ctx, botID)
+	})
+}
+
+// ByBotID resolves a bot by its ID
+func (r *Registry) ByBotID(ctx context.Context, botID string) (*models.BotSettings, error) {
+	return r.lookup(ctx, "id:"+botID, func(ctx context.Context) (*models.BotSettings, error) {
+		return r.storage.GetBotSettings(ctx, botID)
+	})
+}
+
+func (r *Registry) lookup(ctx context.Context, key string, load func(context.Context) (*models.BotSettings, error)) (*models.BotSettings, error) {
+	entry, cached := r.cache.get(key)
+	if cached && time.Now().Before(entry.expiresAt) {
+		if entry.settings == nil {
+			metrics.BotCacheLookups.WithLabelValues("negative_hit").Inc()
+			return nil, storage.ErrNotFound
+		}
+		metrics.BotCacheLookups.WithLabelValues("hit").Inc()
+		return entry.settings, nil
+	}
+
+	settings, err := load(ctx)
+	if errors.Is(err, storage.ErrNotFound) {
+		metrics.BotCacheLookups.WithLabelValues("miss").Inc()
+		r.cache.add(key, nil, r.negativeTTL)
+		return nil, err
+	}
+	if err != nil {
+		// Keep serving what we knew while Redis is unavailable instead of failing all ingress
+		if cached && entry.settings != nil {
+			metrics.BotCacheLookups.WithLabelValues("stale").Inc()
+			r.logger.Warn("serving stale bot registration", zap.String("bot_id", entry.settings.BotID), zap.Error(err))
+			return entry.settings, nil
+		}
+		metrics.BotCacheLookups.WithLabelValues("miss").Inc()
+		return nil, err
+	}
+
+	metrics.BotCacheLookups.WithLabelValues("miss").Inc()
+	r.cache.add(key, settings, r.ttl)
+	return settings, nil
+}
+
+// Watch applies the manager's bot events to the cache until ctx is cancelled.
+// Events lost while the subscription reconnects are covered by the cache TTL.
+func (r *Registry) Watch(ctx context.Context) {
+	for event := range r.storage.SubscribeBotEvents(ctx) {
+		r.logger.Debug("bot event received",
+			zap.String("type", event.Type),
+			zap.String("bot_id", event.BotID))
+
+		switch event.Type {
+		case models.BotEventCreated, models.BotEventTokenRotated:
+			// The new token or webhook ID may have been cached as unknown
+			r.cache.removeNegative()
+			r.cache.removeBot(event.BotID)
+		default:
+			r.cache.removeBot(event.BotID)
+		}
+	}
+}
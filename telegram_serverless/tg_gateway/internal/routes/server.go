@@ -2,32 +2,50 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/ingress"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/registry"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/webhook"
 	"go.uber.org/zap"
 )
 
 type Server struct {
-	app            *fiber.App
-	webhookHandler *webhook.Handler
-	logger         *zap.SugaredLogger
+	app                *fiber.App
+	webhookHandler     *webhook.Handler
+	guard              *ingress.Guard
+	registry           *registry.Registry
+	allowTokenWebhooks bool
+	logger             *zap.SugaredLogger
 }
 
-func NewServer(webhookHandler *webhook.Handler, logger *zap.SugaredLogger) *Server {
+// NewServer builds the webhook server. Bodies over maxBodyBytes are refused while they
+// are read, before a handler runs, and counted by the guard; 0 keeps Fiber's default
+// limit of 4 MB.
+func NewServer(webhookHandler *webhook.Handler, guard *ingress.Guard, registry *registry.Registry,
+	allowTokenWebhooks bool, maxBodyBytes int, logger *zap.SugaredLogger) *Server {
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  15 * 1e9,
 		WriteTimeout: 15 * 1e9,
 		IdleTimeout:  60 * 1e9,
+		BodyLimit:    maxBodyBytes,
+		ErrorHandler: guard.ErrorHandler,
 	})
 
 	return &Server{
-		app:            app,
-		webhookHandler: webhookHandler,
-		logger:         logger,
+		app:                app,
+		webhookHandler:     webhookHandler,
+		guard:              guard,
+		registry:           registry,
+		allowTokenWebhooks: allowTokenWebhooks,
+		logger:             logger,
 	}
 }
 
 func (s *Server) setupRoutes() {
-	s.app.Post("/webhook/:bot_token", s.webhookHandler.HandleWebhook)
+	s.app.Post("/hooks/:webhook_id", s.guard.Handler("webhook_id", s.registry.ByWebhookID), s.webhookHandler.HandleWebhook)
+	if s.allowTokenWebhooks {
+		// Legacy route with the bot token in the path, disable once all webhooks are migrated
+		s.app.Post("/webhook/:bot_token", s.guard.Handler("bot_token", s.registry.ByToken), s.webhookHandler.HandleWebhook)
+	}
 	s.app.Get("/health", healthHandler)
 	s.app.Get("/ready", readyHandler)
 }
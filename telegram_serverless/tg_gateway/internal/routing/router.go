@@ -0,0 +1,63 @@
+package routing
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+)
+
+// patterns caches compiled text patterns, rules are evaluated on every webhook
+var patterns sync.Map // string -> *regexp.Regexp, nil for invalid patterns
+
+// Topic returns the topic suffix of the first rule matching the update,
+// or "incoming" when none does
+func Topic(rules []models.RoutingRule, update *models.UpdateMeta) string {
+	for _, rule := range rules {
+		if matches(&rule, update) {
+			return rule.Topic
+		}
+	}
+	return "incoming"
+}
+
+func matches(rule *models.RoutingRule, update *models.UpdateMeta) bool {
+	if len(rule.UpdateTypes) > 0 && !slices.Contains(rule.UpdateTypes, update.Type) {
+		return false
+	}
+	if len(rule.ChatTypes) > 0 && !slices.Contains(rule.ChatTypes, update.ChatType) {
+		return false
+	}
+	if rule.CommandPrefix != "" && !strings.HasPrefix(command(update.Text), rule.CommandPrefix) {
+		return false
+	}
+	if rule.TextPattern != "" {
+		re := compile(rule.TextPattern)
+		if re == nil || !re.MatchString(update.Text) {
+			return false
+		}
+	}
+	return true
+}
+
+// command returns the leading /command of text without the @botname suffix
+func command(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	cmd, _, _ := strings.Cut(text, " ")
+	cmd, _, _ = strings.Cut(cmd, "@")
+	return cmd
+}
+
+func compile(pattern string) *regexp.Regexp {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	// The manager validates patterns, an invalid one is cached as nil and never matches
+	re, _ := regexp.Compile(pattern)
+	patterns.Store(pattern, re)
+	return re
+}
@@ -0,0 +1,46 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+)
+
+func TestTopic(t *testing.T) {
+	rules := []models.RoutingRule{
+		{Topic: "payments", UpdateTypes: []string{"pre_checkout_query", "shipping_query"}},
+		{Topic: "admin", CommandPrefix: "/admin", ChatTypes: []string{"private"}},
+		{Topic: "orders", TextPattern: `(?i)^order #\d+$`},
+		{Topic: "broken", TextPattern: `(`},
+		{Topic: "groups", UpdateTypes: []string{"message"}, ChatTypes: []string{"group", "supergroup"}},
+	}
+
+	tests := []struct {
+		name   string
+		update models.UpdateMeta
+		want   string
+	}{
+		{"update type", models.UpdateMeta{Type: "pre_checkout_query"}, "payments"},
+		{"command in private chat", models.UpdateMeta{Type: "message", ChatType: "private", Text: "/admin_ban 42"}, "admin"},
+		{"command with bot name", models.UpdateMeta{Type: "message", ChatType: "private", Text: "/admin@shop_bot"}, "admin"},
+		{"command in wrong chat type", models.UpdateMeta{Type: "message", ChatType: "channel", Text: "/admin"}, "incoming"},
+		{"command prefix only at start", models.UpdateMeta{Type: "message", ChatType: "private", Text: "hi /admin"}, "incoming"},
+		{"text pattern", models.UpdateMeta{Type: "message", ChatType: "private", Text: "Order #123"}, "orders"},
+		{"invalid pattern never matches", models.UpdateMeta{Type: "message", ChatType: "channel", Text: "("}, "incoming"},
+		{"first matching rule wins", models.UpdateMeta{Type: "message", ChatType: "group", Text: "order #7"}, "orders"},
+		{"all conditions of a rule", models.UpdateMeta{Type: "message", ChatType: "supergroup", Text: "hello"}, "groups"},
+		{"no rule", models.UpdateMeta{Type: "callback_query", ChatType: "private"}, "incoming"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Topic(rules, &tt.update); got != tt.want {
+				t.Errorf("Topic() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := Topic(nil, &models.UpdateMeta{Type: "message"}); got != "incoming" {
+		t.Errorf("Topic() without rules = %q, want %q", got, "incoming")
+	}
+}
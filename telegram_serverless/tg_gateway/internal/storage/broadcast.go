@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/uchebnick/telegram-serverless/broadcaststatus"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+)
+
+// recordBroadcastResultScript counts one recipient and moves the cursor past it.
+// A broadcast deleted meanwhile isn't recreated.
+var recordBroadcastResultScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+redis.call("HINCRBY", KEYS[1], "cursor", 1)
+redis.call("HSET", KEYS[1], "updated_at", ARGV[2])
+return 1`)
+
+func (r *RedisStorage) ListActiveBroadcasts(ctx context.Context) ([]string, error) {
+	ids, err := r.client.SMembers(ctx, broadcaststatus.ActiveKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active broadcasts: %w", err)
+	}
+	return ids, nil
+}
+
+// GetBroadcast returns ErrNotFound once the manager deleted the broadcast
+func (r *RedisStorage) GetBroadcast(ctx context.Context, id string) (*models.Broadcast, error) {
+	fields, err := r.client.HGetAll(ctx, broadcaststatus.Key(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get broadcast: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+
+	broadcast := &models.Broadcast{
+		ID:        id,
+		BotID:     fields["bot_id"],
+		Method:    fields["method"],
+		Status:    fields["status"],
+		Total:     parseInt(fields["total"]),
+		Cursor:    parseInt(fields["cursor"]),
+		CreatedAt: parseInt(fields["created_at"]),
+	}
+	if err := json.Unmarshal([]byte(fields["params"]), &broadcast.Params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal broadcast params: %w", err)
+	}
+
+	return broadcast, nil
+}
+
+// GetBroadcastStatus returns ErrNotFound once the manager deleted the broadcast
+func (r *RedisStorage) GetBroadcastStatus(ctx context.Context, id string) (string, error) {
+	status, err := r.client.HGet(ctx, broadcaststatus.Key(id), "status").Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get broadcast status: %w", err)
+	}
+	return status, nil
+}
+
+// BroadcastRecipients returns up to count chat ids starting at the recipient index start
+func (r *RedisStorage) BroadcastRecipients(ctx context.Context, id string, start, count int64) ([]int64, error) {
+	key := broadcaststatus.RecipientsKey(id)
+	members, err := r.client.LRange(ctx, key, start, start+count-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get broadcast recipients: %w", err)
+	}
+
+	chatIDs := make([]int64, 0, len(members))
+	for _, member := range members {
+		chatIDs = append(chatIDs, parseInt(member))
+	}
+	return chatIDs, nil
+}
+
+// SetBroadcastStatus moves a broadcast to status if its current status is one of from
+func (r *RedisStorage) SetBroadcastStatus(ctx context.Context, id, status string, from ...string) (bool, error) {
+	changed, err := broadcaststatus.Set(ctx, r.client, id, status, from...)
+	if errors.Is(err, broadcaststatus.ErrNotFound) {
+		return false, ErrNotFound
+	}
+	return changed, err
+}
+
+// RecordBroadcastResult counts the recipient at the cursor as sent, failed or blocked
+func (r *RedisStorage) RecordBroadcastResult(ctx context.Context, id, result string) error {
+	err := recordBroadcastResultScript.Run(ctx, r.client, []string{broadcaststatus.Key(id)}, result, time.Now().Unix()).Err()
+	if err != nil {
+		return fmt.Errorf("failed to record broadcast result: %w", err)
+	}
+	return nil
+}
+
+// AddAudience remembers private chats that talked to their bots as broadcast recipients,
+// in one round trip for every bot
+func (r *RedisStorage) AddAudience(ctx context.Context, chatIDs map[string][]int64) error {
+	pipe := r.client.Pipeline()
+	for botID, ids := range chatIDs {
+		members := make([]interface{}, len(ids))
+		for i, id := range ids {
+			members[i] = id
+		}
+		pipe.SAdd(ctx, fmt.Sprintf("bot:audience:%s", botID), members...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add audience: %w", err)
+	}
+	return nil
+}
+
+// RemoveAudience forgets a chat that blocked the bot
+func (r *RedisStorage) RemoveAudience(ctx context.Context, botID string, chatID int64) error {
+	if err := r.client.SRem(ctx, fmt.Sprintf("bot:audience:%s", botID), chatID).Err(); err != nil {
+		return fmt.Errorf("failed to remove audience: %w", err)
+	}
+	return nil
+}
+
+func parseInt(val string) int64 {
+	n, _ := strconv.ParseInt(val, 10, 64)
+	return n
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Groups upgraded to supergroups get a new chat id. bot:chat_migrations:<id> maps the
+// old ids of a bot's chats to the new ones.
+func chatMigrationsKey(botID string) string {
+	return fmt.Sprintf("bot:chat_migrations:%s", botID)
+}
+
+// MigratedChatID returns the supergroup a group chat was upgraded to, or "" if it wasn't
+func (r *RedisStorage) MigratedChatID(ctx context.Context, botID, chatID string) (string, error) {
+	newChatID, err := r.client.HGet(ctx, chatMigrationsKey(botID), chatID).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat migration: %w", err)
+	}
+	return newChatID, nil
+}
+
+// SaveChatMigration records the upgrade of a group. It reports false if the upgrade
+// was already recorded, e.g. by another replica.
+func (r *RedisStorage) SaveChatMigration(ctx context.Context, botID, oldChatID, newChatID string) (bool, error) {
+	saved, err := r.client.HSetNX(ctx, chatMigrationsKey(botID), oldChatID, newChatID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to save chat migration: %w", err)
+	}
+	return saved, nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenBucket is a rate limit shared by all gateway replicas
+type TokenBucket struct {
+	Key   string
+	Rate  float64 // tokens added per second
+	Burst int
+}
+
+// takeTokenScript takes a token from every bucket only if all of them have one,
+// otherwise it returns how long to wait in ms and the 1-based index of the emptiest bucket.
+// Time comes from Redis so replicas with skewed clocks share the buckets correctly.
+var takeTokenScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local tokens = {}
+local wait, limited = 0, 0
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2 - 1])
+	local burst = tonumber(ARGV[i * 2])
+	local state = redis.call("HMGET", key, "tokens", "ts")
+	local available = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	available = math.min(burst, available + math.max(0, now - ts) * rate / 1000)
+	tokens[i] = available
+	if available < 1 then
+		local missing = math.ceil((1 - available) * 1000 / rate)
+		if missing > wait then
+			wait, limited = missing, i
+		end
+	end
+end
+if wait > 0 then
+	return {wait, limited}
+end
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2 - 1])
+	local burst = tonumber(ARGV[i * 2])
+	redis.call("HSET", key, "tokens", tostring(tokens[i] - 1), "ts", now)
+	redis.call("PEXPIRE", key, math.ceil(burst * 1000 / rate) + 1000)
+end
+return {0, 0}`)
+
+// TakeToken takes one token from each bucket if all of them have one. Otherwise nothing
+// is taken and it returns how long to wait and the index of the bucket that ran out.
+func (r *RedisStorage) TakeToken(ctx context.Context, buckets []TokenBucket) (time.Duration, int, error) {
+	keys := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, 2*len(buckets))
+	for _, b := range buckets {
+		keys = append(keys, b.Key)
+		args = append(args, b.Rate, b.Burst)
+	}
+
+	result, err := takeTokenScript.Run(ctx, r.client, keys, args...).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return time.Duration(result[0]) * time.Millisecond, int(result[1]) - 1, nil
+}
@@ -2,11 +2,24 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
 )
 
+// botEventsChannel is where the manager announces bot registration changes
+const botEventsChannel = "bots:events"
+
+// inlineRepliesChannel is suffixed with the gateway instance waiting for the reply
+const inlineRepliesChannel = "bots:inline_replies:"
+
+// ErrNotFound is returned when a bot is not registered
+var ErrNotFound = errors.New("bot not found")
+
 type RedisStorage struct {
 	client *redis.Client
 }
@@ -29,12 +42,319 @@ func NewRedisStorage(addr, password string, db int) (*RedisStorage, error) {
 func (r *RedisStorage) GetBotIDByToken(ctx context.Context, token string) (string, error) {
 	key := fmt.Sprintf("bot:token:%s", token)
 	botID, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get bot_id for token: %w", err)
 	}
 	return botID, nil
 }
 
+// GetBotIDByWebhookID resolves the opaque webhook path segment of a bot
+func (r *RedisStorage) GetBotIDByWebhookID(ctx context.Context, webhookID string) (string, error) {
+	key := fmt.Sprintf("bot:webhook:%s", webhookID)
+	botID, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get bot_id for webhook id: %w", err)
+	}
+	return botID, nil
+}
+
+// GetBotSettings reads the bot configuration stored by the manager
+func (r *RedisStorage) GetBotSettings(ctx context.Context, botID string) (*models.BotSettings, error) {
+	key := fmt.Sprintf("bot:config:%s", botID)
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bot config: %w", err)
+	}
+
+	var settings models.BotSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bot config: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SubscribeBotEvents streams bot registration changes until ctx is cancelled.
+// Events published while the subscription reconnects are lost.
+func (r *RedisStorage) SubscribeBotEvents(ctx context.Context) <-chan *models.BotEvent {
+	pubsub := r.client.Subscribe(ctx, botEventsChannel)
+	events := make(chan *models.BotEvent, 64)
+
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var event models.BotEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					continue
+				}
+
+				select {
+				case events <- &event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+// Update markers: an update is being published until it is marked published
+const (
+	UpdatePublishing = "publishing"
+	UpdatePublished  = "published"
+)
+
+// claimUpdateScript sets the publishing marker unless the update already has a marker,
+// which it returns instead
+var claimUpdateScript = redis.NewScript(`
+local marker = redis.call("GET", KEYS[1])
+if marker then
+	return marker
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return ""`)
+
+func updateKey(botID string, updateID int) string {
+	return fmt.Sprintf("bot:update:%s:%d", botID, updateID)
+}
+
+// ClaimUpdate marks update_id of botID as being published. It returns "" when the claim
+// succeeded, or the marker the update already has. The claim expires after claimTTL,
+// so an update isn't lost when its gateway dies before publishing it.
+func (r *RedisStorage) ClaimUpdate(ctx context.Context, botID string, updateID int, claimTTL time.Duration) (string, error) {
+	marker, err := claimUpdateScript.Run(ctx, r.client, []string{updateKey(botID, updateID)},
+		UpdatePublishing, claimTTL.Milliseconds()).Text()
+	if err != nil {
+		return "", fmt.Errorf("failed to claim update: %w", err)
+	}
+	return marker, nil
+}
+
+// MarkUpdatePublished records that update_id was published. The marker expires after
+// ttl, which bounds how long redeliveries are caught.
+func (r *RedisStorage) MarkUpdatePublished(ctx context.Context, botID string, updateID int, ttl time.Duration) error {
+	if err := r.client.Set(ctx, updateKey(botID, updateID), UpdatePublished, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to mark update as published: %w", err)
+	}
+	return nil
+}
+
+// ForgetUpdate removes the marker so a redelivery of update_id is accepted again
+func (r *RedisStorage) ForgetUpdate(ctx context.Context, botID string, updateID int) error {
+	if err := r.client.Del(ctx, updateKey(botID, updateID)).Err(); err != nil {
+		return fmt.Errorf("failed to forget update: %w", err)
+	}
+	return nil
+}
+
+// ListBotIDs returns every bot registered by the manager
+func (r *RedisStorage) ListBotIDs(ctx context.Context) ([]string, error) {
+	botIDs, err := r.client.SMembers(ctx, "bots:all").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bots: %w", err)
+	}
+	return botIDs, nil
+}
+
+// renewLeaseScript extends a lease only while owner still holds it
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseLeaseScript deletes a lease only while owner still holds it
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// AcquireLease takes the lease key for owner unless another owner holds it.
+// Leases expire after ttl, so a crashed owner is replaced without coordination.
+func (r *RedisStorage) AcquireLease(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	acquired, err := r.client.SetNX(ctx, key, owner, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	return acquired, nil
+}
+
+// RenewLease extends the lease and reports whether owner still holds it
+func (r *RedisStorage) RenewLease(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	renewed, err := renewLeaseScript.Run(ctx, r.client, []string{key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to renew lease: %w", err)
+	}
+	return renewed == 1, nil
+}
+
+func (r *RedisStorage) ReleaseLease(ctx context.Context, key, owner string) error {
+	if err := releaseLeaseScript.Run(ctx, r.client, []string{key}, owner).Err(); err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
+
+// GetPollOffset returns the next getUpdates offset of a bot, 0 if it never polled
+func (r *RedisStorage) GetPollOffset(ctx context.Context, botID string) (int, error) {
+	key := fmt.Sprintf("bot:poll_offset:%s", botID)
+	offset, err := r.client.Get(ctx, key).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get poll offset: %w", err)
+	}
+	return offset, nil
+}
+
+func (r *RedisStorage) SavePollOffset(ctx context.Context, botID string, offset int) error {
+	key := fmt.Sprintf("bot:poll_offset:%s", botID)
+	if err := r.client.Set(ctx, key, offset, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save poll offset: %w", err)
+	}
+	return nil
+}
+
+// claimInlineReplyScript hands a reply to the waiting webhook. Claiming and publishing
+// happen atomically, so a webhook that failed to cancel its wait knows the reply is on its way.
+// The command is kept at KEYS[2] for a while, so a webhook whose reply got lost in pub/sub
+// can still send it.
+var claimInlineReplyScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if not owner then
+	return 0
+end
+redis.call("DEL", KEYS[1])
+redis.call("SET", KEYS[2], ARGV[3], "PX", ARGV[4])
+return redis.call("PUBLISH", ARGV[1] .. owner, ARGV[2])`)
+
+// claimedInlineReplyTTL bounds how long a claimed command is kept for a lost reply
+const claimedInlineReplyTTL = time.Minute
+
+func inlineWaitKey(botID string, updateID int) string {
+	return fmt.Sprintf("bot:inline_wait:%s:%d", botID, updateID)
+}
+
+func inlineClaimedKey(botID string, updateID int) string {
+	return fmt.Sprintf("bot:inline_claimed:%s:%d", botID, updateID)
+}
+
+// WaitInlineReply announces that owner holds the webhook of update_id open for ttl
+func (r *RedisStorage) WaitInlineReply(ctx context.Context, botID string, updateID int, owner string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, inlineWaitKey(botID, updateID), owner, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to register inline reply wait: %w", err)
+	}
+	return nil
+}
+
+// CancelInlineReply withdraws the wait and reports false if a reply was claimed before
+func (r *RedisStorage) CancelInlineReply(ctx context.Context, botID string, updateID int) (bool, error) {
+	deleted, err := r.client.Del(ctx, inlineWaitKey(botID, updateID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel inline reply wait: %w", err)
+	}
+	return deleted == 1, nil
+}
+
+// ClaimInlineReply sends reply to the waiting webhook and reports whether a gateway received it.
+// cmd is the command the reply was made of, kept in case the reply doesn't arrive.
+func (r *RedisStorage) ClaimInlineReply(ctx context.Context, reply *models.InlineReply, cmd *models.OutgoingCommand) (bool, error) {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal inline reply: %w", err)
+	}
+	cmdData, err := json.Marshal(cmd)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	keys := []string{inlineWaitKey(reply.BotID, reply.UpdateID), inlineClaimedKey(reply.BotID, reply.UpdateID)}
+	receivers, err := claimInlineReplyScript.Run(ctx, r.client, keys,
+		inlineRepliesChannel, data, cmdData, claimedInlineReplyTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim inline reply: %w", err)
+	}
+	return receivers > 0, nil
+}
+
+// TakeClaimedCommand returns the command claimed for the webhook of update_id and forgets it,
+// or nil if there is none
+func (r *RedisStorage) TakeClaimedCommand(ctx context.Context, botID string, updateID int) (*models.OutgoingCommand, error) {
+	data, err := r.client.GetDel(ctx, inlineClaimedKey(botID, updateID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get claimed command: %w", err)
+	}
+
+	var cmd models.OutgoingCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal claimed command: %w", err)
+	}
+	return &cmd, nil
+}
+
+// SubscribeInlineReplies streams the inline replies addressed to owner until ctx is cancelled
+func (r *RedisStorage) SubscribeInlineReplies(ctx context.Context, owner string) <-chan *models.InlineReply {
+	pubsub := r.client.Subscribe(ctx, inlineRepliesChannel+owner)
+	replies := make(chan *models.InlineReply, 64)
+
+	go func() {
+		defer close(replies)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var reply models.InlineReply
+				if err := json.Unmarshal([]byte(msg.Payload), &reply); err != nil {
+					continue
+				}
+
+				select {
+				case replies <- &reply:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return replies
+}
+
 func (r *RedisStorage) GetOutgoingTopic(ctx context.Context, botID string) (string, error) {
 	return fmt.Sprintf("bot_%s_outgoing", botID), nil
 }
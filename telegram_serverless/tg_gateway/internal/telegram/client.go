@@ -1,84 +1,56 @@
 package telegram
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
 	"time"
 
-	"go.uber.org/zap"
+	"github.com/uchebnick/telegram-serverless/botapi"
+)
+
+const (
+	callTimeout = 30 * time.Second
+	// uploadTimeout allows for large files, which take longer than regular calls
+	uploadTimeout = 5 * time.Minute
 )
 
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     *zap.SugaredLogger
+	api *botapi.Client
 }
 
-var apiResp struct {
-	Ok          bool            `json:"ok"`
-	Result      json.RawMessage `json:"result"`
-	Description string          `json:"description"`
-	ErrorCode   int             `json:"error_code"`
+func NewClient(baseURL string) *Client {
+	return &Client{api: botapi.NewClient(baseURL, callTimeout, uploadTimeout)}
 }
 
-func NewClient(baseURL string, logger *zap.SugaredLogger) *Client {
-	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		logger: logger,
+// WithBaseURL returns a client that talks to another Bot API server.
+// An empty baseURL keeps the current server.
+func (c *Client) WithBaseURL(baseURL string) *Client {
+	api := c.api.WithBaseURL(baseURL)
+	if api == c.api {
+		return c
 	}
+	return &Client{api: api}
 }
 
 func (c *Client) CallMethod(botToken, method string, params map[string]interface{}) ([]byte, error) {
-	url := fmt.Sprintf("%s/bot%s/%s", c.baseURL, botToken, method)
-
-	var reqBody []byte
-	var err error
-	if params != nil {
-		reqBody, err = json.Marshal(params)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal params: %w", err)
-		}
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		c.logger.Error("telegram handlers error",
-			zap.String("method", method),
-			zap.Int("status_code", resp.StatusCode),
-			zap.String("response", string(respBody)))
-		return nil, fmt.Errorf("telegram handlers returned status %d: %s", resp.StatusCode, string(respBody))
-	}
+	return c.CallMethodContext(context.Background(), botToken, method, params)
+}
 
-	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+// CallMethodContext is CallMethod bound to ctx, e.g. for long polls that must stop on shutdown
+func (c *Client) CallMethodContext(ctx context.Context, botToken, method string, params map[string]interface{}) ([]byte, error) {
+	// A nil map would be sent as null
+	if params == nil {
+		return c.api.Post(ctx, botToken, method, nil)
 	}
+	return c.api.Post(ctx, botToken, method, params)
+}
 
-	if !apiResp.Ok {
-		return nil, fmt.Errorf("telegram handlers error [%d]: %s", apiResp.ErrorCode, apiResp.Description)
-	}
+// call makes a typed method call, decoding the method's result into result unless it is nil
+func (c *Client) call(ctx context.Context, botToken, method string, params, result interface{}) error {
+	return c.api.Call(ctx, botToken, method, params, result)
+}
 
-	return apiResp.Result, nil
+// CallMethodMultipart calls method with params as form fields and files as uploads.
+// The files are streamed into the request rather than buffered.
+func (c *Client) CallMethodMultipart(ctx context.Context, botToken, method string, params map[string]interface{}, files []botapi.InputFile) ([]byte, error) {
+	return c.api.PostMultipart(ctx, botToken, method, params, files)
 }
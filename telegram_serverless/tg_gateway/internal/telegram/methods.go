@@ -0,0 +1,22 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// GetUpdates long-polls for updates starting at offset and returns them unparsed
+func (c *Client) GetUpdates(ctx context.Context, botToken string, offset int, timeout time.Duration) ([]json.RawMessage, error) {
+	params := GetUpdatesParams{
+		Offset:  offset,
+		Timeout: int(timeout.Seconds()),
+		Limit:   100,
+	}
+
+	var updates []json.RawMessage
+	if err := c.call(ctx, botToken, "getUpdates", params, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
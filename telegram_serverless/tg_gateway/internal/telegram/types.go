@@ -0,0 +1,8 @@
+package telegram
+
+type GetUpdatesParams struct {
+	Offset         int      `json:"offset,omitempty"`
+	Limit          int      `json:"limit,omitempty"`
+	Timeout        int      `json:"timeout,omitempty"` // seconds
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
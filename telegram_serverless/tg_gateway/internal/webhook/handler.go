@@ -2,74 +2,267 @@ package webhook
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/audience"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/dedup"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/inline"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/kafka"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/metrics"
 	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
-	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/storage"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/registry"
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/routing"
 	"go.uber.org/zap"
 )
 
+// ErrInvalidUpdate is returned by Ingest for bodies that are not a Telegram update
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// ErrUpdateInFlight is returned by Ingest while another request is still publishing the
+// same update; Telegram retries it, and the retry is dropped once the publish succeeded
+var ErrUpdateInFlight = errors.New("update is still being published")
+
+const (
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	// durablePublishTimeout keeps a durable write well inside Telegram's webhook timeout
+	durablePublishTimeout = 10 * time.Second
+)
+
 type Handler struct {
-	storage  *storage.RedisStorage
-	producer *kafka.Producer
-	logger   *zap.SugaredLogger
+	registry     *registry.Registry
+	dedup        *dedup.Deduplicator
+	producer     *kafka.Producer
+	replies      *inline.Replies
+	audience     *audience.Recorder
+	deliveryMode string        // default for bots that don't set their own
+	inlineBudget time.Duration // default for bots that don't set their own
+	logger       *zap.SugaredLogger
 }
 
-func NewHandler(storage *storage.RedisStorage, producer *kafka.Producer, logger *zap.SugaredLogger) *Handler {
+func NewHandler(
+	registry *registry.Registry,
+	dedup *dedup.Deduplicator,
+	producer *kafka.Producer,
+	replies *inline.Replies,
+	audience *audience.Recorder,
+	deliveryMode string,
+	inlineBudget time.Duration,
+	logger *zap.SugaredLogger,
+) *Handler {
 	return &Handler{
-		storage:  storage,
-		producer: producer,
-		logger:   logger,
+		registry:     registry,
+		dedup:        dedup,
+		producer:     producer,
+		replies:      replies,
+		audience:     audience,
+		deliveryMode: deliveryMode,
+		inlineBudget: inlineBudget,
+		logger:       logger,
 	}
 }
 
 // HandleWebhook processes incoming webhook from Telegram
-// POST /webhook/{bot_token}
+// POST /hooks/{webhook_id}
+// POST /webhook/{bot_token} (legacy, kept while bots migrate to opaque paths)
 func (h *Handler) HandleWebhook(c *fiber.Ctx) error {
-	botToken := c.Params("bot_token")
+	ctx := context.Background()
 
-	if botToken == "" {
-		return c.Status(fiber.StatusBadRequest).SendString("bot_token is required")
+	var settings *models.BotSettings
+	if webhookID := c.Params("webhook_id"); webhookID != "" {
+		var err error
+		settings, err = h.registry.ByWebhookID(ctx, webhookID)
+		if err != nil {
+			h.logger.Error("failed to resolve webhook id", zap.Error(err))
+			return c.Status(fiber.StatusNotFound).SendString("bot not found")
+		}
+
+		if !secretMatches(c.Get(secretTokenHeader), settings.WebhookSecret) {
+			h.logger.Warn("rejected webhook with invalid secret token",
+				zap.String("bot_id", settings.BotID))
+			return c.Status(fiber.StatusUnauthorized).SendString("invalid secret token")
+		}
+	} else {
+		botToken := c.Params("bot_token")
+		if botToken == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("bot_token is required")
+		}
+
+		var err error
+		settings, err = h.registry.ByToken(ctx, botToken)
+		if err != nil {
+			h.logger.Error("failed to get bot_id",
+				zap.String("bot_token", maskToken(botToken)),
+				zap.Error(err))
+			return c.Status(fiber.StatusNotFound).SendString("bot not found")
+		}
+
+		h.logger.Debug("webhook received on legacy token path", zap.String("bot_id", settings.BotID))
 	}
+	// Forward the body as received; fasthttp reuses its buffer after the handler returns
+	body := append([]byte(nil), c.Body()...)
 
-	var update models.TelegramUpdate
-	if err := c.BodyParser(&update); err != nil {
-		h.logger.Error("failed to unmarshal update", zap.Error(err))
-		return c.Status(fiber.StatusBadRequest).SendString("invalid json")
+	waitReply := settings.InlineReplies && h.replies != nil
+	waiter, err := h.ingest(ctx, settings, body, waitReply, false)
+	if err != nil {
+		if errors.Is(err, ErrInvalidUpdate) {
+			h.logger.Error("failed to parse update", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).SendString("invalid json")
+		}
+		if errors.Is(err, ErrUpdateInFlight) {
+			return c.Status(fiber.StatusServiceUnavailable).SendString("update in flight")
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString("internal error")
 	}
 
-	ctx := context.Background()
-	botID, err := h.storage.GetBotIDByToken(ctx, botToken)
+	// Answer with the worker's method call if it replies within the budget
+	if waiter != nil {
+		if reply := waiter.Await(ctx); reply != nil {
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.Send(reply)
+		}
+	}
+
+	return c.SendString("ok")
+}
+
+// Ingest publishes one raw update of a polled bot. Only the routing fields are parsed,
+// the update itself is forwarded untouched. The write is durable whatever the bot's
+// delivery mode, since the poller moves its offset past the update once Ingest returns.
+func (h *Handler) Ingest(ctx context.Context, settings *models.BotSettings, raw []byte) error {
+	_, err := h.ingest(ctx, settings, raw, false, true)
+	return err
+}
+
+// ingest publishes the update and, with waitReply, returns a waiter for the worker's
+// inline reply. The wait is registered before publishing so a fast reply isn't missed.
+// durable forces a durable write regardless of the bot's delivery mode.
+func (h *Handler) ingest(ctx context.Context, settings *models.BotSettings, raw []byte, waitReply, durable bool) (*inline.Waiter, error) {
+	botID := settings.BotID
+
+	update, err := models.ParseUpdate(raw)
 	if err != nil {
-		h.logger.Error("failed to get bot_id",
-			zap.String("bot_token", maskToken(botToken)),
-			zap.Error(err))
-		return c.Status(fiber.StatusNotFound).SendString("bot not found")
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+
+	// Telegram redelivers updates after slow or failed responses; acknowledge them without
+	// republishing, but only once the first delivery was published
+	switch h.dedup.Claim(ctx, botID, update.UpdateID) {
+	case dedup.Duplicate:
+		metrics.DuplicateUpdates.WithLabelValues(botID).Inc()
+		h.logger.Debug("duplicate update dropped",
+			zap.String("bot_id", botID),
+			zap.Int("update_id", update.UpdateID))
+		return nil, nil
+	case dedup.InFlight:
+		h.logger.Debug("update redelivered while publishing",
+			zap.String("bot_id", botID),
+			zap.Int("update_id", update.UpdateID))
+		return nil, ErrUpdateInFlight
+	}
+
+	var waiter *inline.Waiter
+	if waitReply {
+		budget := h.inlineBudget
+		if settings.InlineReplyBudget > 0 {
+			budget = time.Duration(settings.InlineReplyBudget) * time.Millisecond
+		}
+
+		waiter, err = h.replies.Register(ctx, botID, update.UpdateID, budget)
+		if err != nil {
+			h.logger.Error("failed to wait for inline reply", zap.String("bot_id", botID), zap.Error(err))
+		}
 	}
 
 	incomingMsg := models.IncomingMessage{
 		BotID:  botID,
-		Update: update,
+		Update: raw,
 	}
 
-	topic := fmt.Sprintf("bot_%s_incoming", botID)
-	key := fmt.Sprintf("%d", update.UpdateID)
+	topic := fmt.Sprintf("bot_%s_%s", botID, routing.Topic(settings.Routes, update))
+	key := partitionKey(settings.PartitionStrategy, update)
 
-	if err := h.producer.PublishMessage(ctx, topic, key, incomingMsg); err != nil {
+	if err := h.publish(ctx, settings, topic, key, incomingMsg, durable); err != nil {
 		h.logger.Error("failed to publish to kafka",
 			zap.String("bot_id", botID),
 			zap.String("topic", topic),
 			zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).SendString("internal error")
+		h.dedup.Forget(ctx, botID, update.UpdateID)
+		if waiter != nil {
+			waiter.Cancel(ctx)
+		}
+		return nil, err
 	}
 
-	h.logger.Debug("webhook processed",
+	h.dedup.Published(ctx, botID, update.UpdateID)
+
+	h.logger.Debug("update published",
 		zap.String("bot_id", botID),
 		zap.Int("update_id", update.UpdateID))
 
-	return c.SendString("ok")
+	// Private chats that talked to the bot make up its broadcast audience
+	if update.ChatType == "private" && update.ChatID != 0 {
+		h.audience.Add(botID, update.ChatID)
+	}
+
+	return waiter, nil
+}
+
+// publish writes the update in the bot's delivery mode, or durably if durable is set.
+// In durable mode Telegram only gets a 200 once the broker acked, so a failed write is
+// retried by Telegram.
+func (h *Handler) publish(ctx context.Context, settings *models.BotSettings, topic, key string, msg models.IncomingMessage, durable bool) error {
+	mode := settings.DeliveryMode
+	if mode == "" {
+		mode = h.deliveryMode
+	}
+
+	if mode != models.DeliveryDurable && !durable {
+		return h.producer.PublishMessage(ctx, topic, key, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, durablePublishTimeout)
+	defer cancel()
+	return h.producer.PublishDurable(ctx, topic, key, msg)
+}
+
+// partitionKey keys updates so that those of one conversation stay in order.
+// Updates without a chat fall back to the user and vice versa; an empty key means round-robin.
+func partitionKey(strategy string, update *models.UpdateMeta) string {
+	var id int64
+	switch strategy {
+	case models.PartitionRoundRobin:
+		return ""
+	case models.PartitionByUser:
+		id = update.UserID
+		if id == 0 {
+			id = update.ChatID
+		}
+	default:
+		id = update.ChatID
+		if id == 0 {
+			id = update.UserID
+		}
+	}
+
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// secretMatches compares the secret token in constant time.
+// Bots without a secret never match, so a missing secret can't open the endpoint.
+func secretMatches(received, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(received), []byte(expected)) == 1
 }
 
 func maskToken(token string) string {
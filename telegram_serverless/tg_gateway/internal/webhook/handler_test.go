@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/uchebnick/telegram-serverless/tg_gateway/internal/models"
+)
+
+func TestPartitionKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		update   models.UpdateMeta
+		want     string
+	}{
+		{"chat", models.PartitionByChat, models.UpdateMeta{ChatID: -100123, UserID: 7}, "-100123"},
+		{"default is chat", "", models.UpdateMeta{ChatID: 42, UserID: 7}, "42"},
+		{"chat falls back to user", models.PartitionByChat, models.UpdateMeta{UserID: 7}, "7"},
+		{"user", models.PartitionByUser, models.UpdateMeta{ChatID: 42, UserID: 7}, "7"},
+		{"user falls back to chat", models.PartitionByUser, models.UpdateMeta{ChatID: 42}, "42"},
+		{"round robin", models.PartitionRoundRobin, models.UpdateMeta{ChatID: 42, UserID: 7}, ""},
+		{"neither chat nor user", models.PartitionByChat, models.UpdateMeta{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partitionKey(tt.strategy, &tt.update); got != tt.want {
+				t.Errorf("partitionKey(%q) = %q, want %q", tt.strategy, got, tt.want)
+			}
+		})
+	}
+}
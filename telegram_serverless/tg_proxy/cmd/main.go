@@ -13,6 +13,8 @@ import (
 	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/handlers"
 	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/kafka"
 	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/routes"
+	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/telegram"
+	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/updates"
 	"go.uber.org/zap"
 )
 
@@ -28,10 +30,15 @@ func main() {
 	producer := kafka.NewProducer(cfg.KafkaBrokers, logger, cfg.OutgoingTopic)
 	defer producer.Close()
 
-	consumer := kafka.NewConsumer(cfg.KafkaBrokers, cfg.BotID, cfg.IncomingTopic, logger)
+	consumer := kafka.NewConsumer(cfg.KafkaBrokers, cfg.ConsumerGroup,
+		append([]string{cfg.IncomingTopic}, cfg.RouteTopics...), logger)
 	defer consumer.Close()
 
-	apiHandlers := handlers.NewHandlers(producer, consumer, logger)
+	tgClient := telegram.NewClient(cfg.TelegramAPIURL, logger)
+
+	updateQueue := updates.NewQueue(consumer, logger)
+
+	apiHandlers := handlers.NewHandlers(producer, updateQueue, tgClient, cfg.BotToken, cfg.MaxAttachmentBytes, logger)
 	server := routes.NewServer(apiHandlers, logger)
 
 	metricsSrv := newMetricsServer(cfg.MetricsPort, logger)
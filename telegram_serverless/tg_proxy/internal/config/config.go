@@ -2,28 +2,41 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
-	Port          string
-	KafkaBrokers  []string
-	MetricsPort   string
-	LogLevel      string
-	BotToken      string
-	IncomingTopic string
-	OutgoingTopic string
+	Port           string
+	KafkaBrokers   []string
+	MetricsPort    string
+	LogLevel       string
+	BotToken       string
+	IncomingTopic  string
+	RouteTopics    []string // set by the manager when the bot has routing rules
+	OutgoingTopic  string
+	ConsumerGroup  string
+	TelegramAPIURL string
+	// MaxAttachmentBytes bounds the files of one call, which travel inline through Kafka
+	MaxAttachmentBytes int64
 }
 
 func Load() *Config {
+	maxAttachmentBytes, _ := strconv.ParseInt(getEnv("MAX_ATTACHMENT_BYTES", "716800"), 10, 64)
 
 	return &Config{
-		Port:          getEnv("PORT", "8080"),
-		KafkaBrokers:  []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
-		MetricsPort:   getEnv("METRICS_PORT", "9090"),
-		LogLevel:      getEnv("LOG_LEVEL", "info"),
-		BotToken:      getEnv("BOT_TOKEN", ""),
-		IncomingTopic: getEnv("INCOMING_TOPIC", ""),
-		OutgoingTopic: getEnv("OUTGOING_TOPIC", ""),
+		Port:           getEnv("PORT", "8080"),
+		KafkaBrokers:   []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
+		MetricsPort:    getEnv("METRICS_PORT", "9090"),
+		LogLevel:       getEnv("LOG_LEVEL", "info"),
+		BotToken:       getEnv("BOT_TOKEN", ""),
+		IncomingTopic:  getEnv("INCOMING_TOPIC", ""),
+		RouteTopics:    splitList(getEnv("ROUTE_TOPICS", "")),
+		OutgoingTopic:  getEnv("OUTGOING_TOPIC", ""),
+		ConsumerGroup:  getEnv("KAFKA_CONSUMER_GROUP", ""),
+		TelegramAPIURL: getEnv("TELEGRAM_API_URL", "https://api.telegram.org"),
+
+		MaxAttachmentBytes: maxAttachmentBytes,
 	}
 }
 
@@ -33,3 +46,13 @@ func getEnv(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,33 +2,57 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/kafka"
 	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/models"
+	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/telegram"
+	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/updates"
 	"go.uber.org/zap"
 )
 
 type Handlers struct {
-	producer *kafka.Producer
-	consumer *kafka.Consumer
-	logger   *zap.SugaredLogger
+	producer           *kafka.Producer
+	updates            *updates.Queue
+	tgClient           *telegram.Client
+	botToken           string // only the sidecar holds the token, the token in worker urls is ignored
+	maxAttachmentBytes int64
+	logger             *zap.SugaredLogger
 }
 
-func NewHandlers(producer *kafka.Producer, consumer *kafka.Consumer, logger *zap.SugaredLogger) *Handlers {
+func NewHandlers(producer *kafka.Producer, updateQueue *updates.Queue, tgClient *telegram.Client, botToken string, maxAttachmentBytes int64, logger *zap.SugaredLogger) *Handlers {
 	return &Handlers{
-		producer: producer,
-		consumer: consumer,
-		logger:   logger,
+		producer:           producer,
+		updates:            updateQueue,
+		tgClient:           tgClient,
+		botToken:           botToken,
+		maxAttachmentBytes: maxAttachmentBytes,
+		logger:             logger,
 	}
 }
 
-// GetUpdates handles GET bot:token/getUpdates
-// Возвращает все updates из Kafka топика
+// GetUpdates handles GET/POST bot:token/getUpdates
+// Serves the bot's incoming topic with the Bot API's long polling semantics
 func (h *Handlers) GetUpdates(c *fiber.Ctx) error {
-	messages, err := h.consumer.ReadAllMessages(c.UserContext())
+	params, err := getUpdatesParams(c)
 	if err != nil {
-		h.logger.Errorw("failed to read messages", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":          false,
+			"error_code":  400,
+			"description": "Bad Request: " + err.Error(),
+		})
+	}
+
+	updates, err := h.updates.GetUpdates(c.UserContext(), params)
+	if err != nil {
+		h.logger.Errorw("failed to read updates", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"ok":          false,
 			"error_code":  500,
@@ -36,22 +60,7 @@ func (h *Handlers) GetUpdates(c *fiber.Ctx) error {
 		})
 	}
 
-	updates := make([]models.TelegramUpdate, 0, len(messages))
-	for _, msg := range messages {
-		var incoming models.TelegramUpdate
-		if err := json.Unmarshal(msg.Value, &incoming); err != nil {
-			h.logger.Errorw("failed to parse message",
-				"error", err,
-				"offset", msg.Offset)
-			continue
-		}
-		updates = append(updates, incoming)
-	}
-
-	h.logger.Infow("processed messages",
-		"total", len(messages),
-		"parsed", len(updates),
-		"failed", len(messages)-len(updates))
+	h.logger.Debugw("returning updates", "offset", params.Offset, "count", len(updates))
 
 	return c.JSON(fiber.Map{
 		"ok":     true,
@@ -59,16 +68,120 @@ func (h *Handlers) GetUpdates(c *fiber.Ctx) error {
 	})
 }
 
+// getUpdatesParams reads the parameters from a JSON body, a form or the query string,
+// whichever the client used
+func getUpdatesParams(c *fiber.Ctx) (updates.Params, error) {
+	var params updates.Params
+
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationJSON) && len(c.Body()) > 0 {
+		var body struct {
+			Offset         int64    `json:"offset"`
+			Limit          int      `json:"limit"`
+			Timeout        int      `json:"timeout"`
+			AllowedUpdates []string `json:"allowed_updates"`
+		}
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return params, fmt.Errorf("invalid JSON")
+		}
+		params.Offset = body.Offset
+		params.Limit = body.Limit
+		params.Timeout = time.Duration(body.Timeout) * time.Second
+		params.AllowedUpdates = body.AllowedUpdates
+		return params, nil
+	}
+
+	var err error
+	if v := c.FormValue("offset"); v != "" {
+		if params.Offset, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return params, fmt.Errorf("invalid offset")
+		}
+	}
+	if v := c.FormValue("limit"); v != "" {
+		if params.Limit, err = strconv.Atoi(v); err != nil {
+			return params, fmt.Errorf("invalid limit")
+		}
+	}
+	if v := c.FormValue("timeout"); v != "" {
+		timeout, err := strconv.Atoi(v)
+		if err != nil {
+			return params, fmt.Errorf("invalid timeout")
+		}
+		params.Timeout = time.Duration(timeout) * time.Second
+	}
+	// A list in a form or query string is JSON-encoded
+	if v := c.FormValue("allowed_updates"); v != "" {
+		if err := json.Unmarshal([]byte(v), &params.AllowedUpdates); err != nil {
+			return params, fmt.Errorf("invalid allowed_updates")
+		}
+	}
+	return params, nil
+}
+
 // GetMe handles GET bot:token/getMe
 func (h *Handlers) GetMe(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"ok": true})
 }
 
+// GetFile handles GET/POST bot:token/getFile
+// getFile needs an answer right away, so it goes straight to the Bot API server instead of Kafka
+func (h *Handlers) GetFile(c *fiber.Ctx) error {
+	fileID := c.Query("file_id")
+	if fileID == "" {
+		var params struct {
+			FileID string `json:"file_id" form:"file_id"`
+		}
+		if err := c.BodyParser(&params); err == nil {
+			fileID = params.FileID
+		}
+	}
+
+	if fileID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":          false,
+			"error_code":  400,
+			"description": "Bad Request: file_id is required",
+		})
+	}
+
+	body, status, err := h.tgClient.GetFile(c.UserContext(), h.botToken, fileID)
+	if err != nil {
+		h.logger.Errorw("failed to call getFile", "error", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"ok":          false,
+			"error_code":  502,
+			"description": "Failed to reach bot api server",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(status).Send(body)
+}
+
+// DownloadFile handles GET file/bot:token/*
+// Streams a file from the bot's Bot API server
+func (h *Handlers) DownloadFile(c *fiber.Ctx) error {
+	filePath := c.Params("*")
+
+	resp, err := h.tgClient.DownloadFile(c.UserContext(), h.botToken, filePath)
+	if err != nil {
+		h.logger.Errorw("failed to download file", "error", err)
+		return c.Status(fiber.StatusBadGateway).SendString("failed to reach bot api server")
+	}
+
+	c.Status(resp.StatusCode)
+	if contentType := resp.Header.Get(fiber.HeaderContentType); contentType != "" {
+		c.Set(fiber.HeaderContentType, contentType)
+	}
+
+	// The body is closed by fasthttp once it has been sent
+	return c.SendStream(resp.Body, int(resp.ContentLength))
+}
+
 // CallMethod handles all POST methods (sendMessage, sendPhoto, etc.)
 // POST bot:token/method:
+// An X-Request-Id header is passed on so the worker can find the outcome in its results topic
 func (h *Handlers) CallMethod(c *fiber.Ctx) error {
 	method := c.Params("method")
-	botToken := c.Params("token")
 
 	if method == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -79,7 +192,34 @@ func (h *Handlers) CallMethod(c *fiber.Ctx) error {
 	}
 
 	var params map[string]interface{}
-	if err := c.BodyParser(&params); err != nil {
+	var attachments []models.Attachment
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":          false,
+				"error_code":  400,
+				"description": "Invalid multipart form",
+			})
+		}
+
+		params, attachments, err = h.formParams(form)
+		if errors.Is(err, errAttachmentsTooLarge) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"ok":          false,
+				"error_code":  413,
+				"description": "Request Entity Too Large",
+			})
+		}
+		if err != nil {
+			h.logger.Errorw("failed to read uploaded files", "error", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":          false,
+				"error_code":  400,
+				"description": "Invalid multipart form",
+			})
+		}
+	} else if err := c.BodyParser(&params); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"ok":          false,
 			"error_code":  400,
@@ -92,9 +232,10 @@ func (h *Handlers) CallMethod(c *fiber.Ctx) error {
 		"params", params)
 
 	outgoing := models.OutgoingCommand{
-		Method:   method,
-		Params:   params,
-		BotToken: botToken,
+		Method:      method,
+		Params:      params,
+		RequestID:   c.Get("X-Request-Id"),
+		Attachments: attachments,
 	}
 	if err := h.producer.PublishMessage(c.UserContext(), outgoing); err != nil {
 		h.logger.Errorw("failed to publish message", "error", err)
@@ -107,3 +248,72 @@ func (h *Handlers) CallMethod(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"ok": true})
 }
+
+var errAttachmentsTooLarge = errors.New("attachments too large")
+
+// formParams turns a multipart call into params and inline attachments. A file sent
+// directly as a field, e.g. photo, becomes photo=attach://photo; files referenced
+// through attach:// inside other fields, as sendMediaGroup does, are left as they are.
+func (h *Handlers) formParams(form *multipart.Form) (map[string]interface{}, []models.Attachment, error) {
+	params := make(map[string]interface{}, len(form.Value)+len(form.File))
+	for name, values := range form.Value {
+		if len(values) > 0 {
+			params[name] = values[0]
+		}
+	}
+
+	var total int64
+	attachments := make([]models.Attachment, 0, len(form.File))
+	for name, files := range form.File {
+		if len(files) == 0 {
+			continue
+		}
+		file := files[0]
+
+		total += file.Size
+		if total > h.maxAttachmentBytes {
+			return nil, nil, errAttachmentsTooLarge
+		}
+
+		data, err := readFormFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		attachments = append(attachments, models.Attachment{
+			Name:        name,
+			Filename:    file.Filename,
+			ContentType: file.Header.Get(fiber.HeaderContentType),
+			Data:        data,
+		})
+
+		if !referencesAttachment(form.Value, name) {
+			params[name] = "attach://" + name
+		}
+	}
+
+	return params, attachments, nil
+}
+
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", file.Filename, err)
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+func referencesAttachment(values map[string][]string, name string) bool {
+	ref := "attach://" + name
+	for _, vals := range values {
+		for _, v := range vals {
+			// Inside JSON such as media the reference is a quoted string
+			if v == ref || strings.Contains(v, `"`+ref+`"`) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -11,22 +11,29 @@ import (
 type Consumer struct {
 	reader *kafka.Reader
 	logger *zap.SugaredLogger
-	topic  string
 }
 
-func NewConsumer(brokers []string, groupID string, topic string, logger *zap.SugaredLogger) *Consumer {
+// NewConsumer reads topics, the bot's incoming topic followed by its route topics.
+// Only a consumer group can read several topics; without one only the first is read.
+func NewConsumer(brokers []string, groupID string, topics []string, logger *zap.SugaredLogger) *Consumer {
 	config := kafka.ReaderConfig{
 		Brokers:  brokers,
-		Topic:    topic,
 		MinBytes: 10e3, // 10KB
 		MaxBytes: 10e6, // 10MB
 	}
 
 	if groupID != "" {
 		config.GroupID = groupID
+		config.GroupTopics = topics
 		config.CommitInterval = time.Second
 		config.StartOffset = kafka.LastOffset
 	} else {
+		if len(topics) > 1 {
+			logger.Warnw("route topics need a consumer group, reading only the first topic", "topics", topics)
+		}
+		if len(topics) > 0 {
+			config.Topic = topics[0]
+		}
 		config.StartOffset = kafka.FirstOffset
 	}
 
@@ -35,56 +42,21 @@ func NewConsumer(brokers []string, groupID string, topic string, logger *zap.Sug
 	return &Consumer{
 		reader: reader,
 		logger: logger,
-		topic:  topic,
 	}
 }
 
-func (c *Consumer) ReadAllMessages(ctx context.Context) ([]kafka.Message, error) {
-	var messages []kafka.Message
-
-	conn, err := kafka.DialLeader(ctx, "tcp", c.reader.Config().Brokers[0], c.topic, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	_, highWaterMark, err := conn.ReadOffsets()
-	if err != nil {
-		conn.Close()
-		return nil, err
-	}
-	conn.Close()
-
-	c.logger.Infow("reading messages from topic",
-		"topic", c.topic,
-		"high_water_mark", highWaterMark)
-
-	for {
-		readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		msg, err := c.reader.ReadMessage(readCtx)
-		cancel()
-
-		if err != nil {
-			if err == context.DeadlineExceeded {
-				c.logger.Info("reached end of topic (timeout)")
-				break
-			}
-			if err == context.Canceled {
-				break
-			}
-			c.logger.Errorw("failed to read message", "error", err)
-			break
-		}
-
-		messages = append(messages, msg)
+// FetchMessage returns the next message without committing it
+func (c *Consumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	return c.reader.FetchMessage(ctx)
+}
 
-		if msg.Offset >= highWaterMark-1 {
-			c.logger.Info("reached end of topic (high water mark)")
-			break
-		}
+// CommitMessages commits the offsets of msgs. Without a consumer group there are
+// no offsets to keep, so it does nothing.
+func (c *Consumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if c.reader.Config().GroupID == "" {
+		return nil
 	}
-
-	c.logger.Infow("finished reading messages", "count", len(messages))
-	return messages, nil
+	return c.reader.CommitMessages(ctx, msgs...)
 }
 
 func (c *Consumer) Close() error {
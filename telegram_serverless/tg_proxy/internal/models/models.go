@@ -2,56 +2,27 @@ package models
 
 import "encoding/json"
 
-type TelegramUpdate struct {
-	UpdateID    int             `json:"update_id"`
-	Message     *Message        `json:"message,omitempty"`
-	Callback    *CallbackQuery  `json:"callback_query,omitempty"`
-	InlineQuery *InlineQuery    `json:"inline_query,omitempty"`
-	Raw         json.RawMessage `json:"-"`
-}
-
-type Message struct {
-	MessageID int    `json:"message_id"`
-	From      *User  `json:"from,omitempty"`
-	Chat      *Chat  `json:"chat"`
-	Date      int64  `json:"date"`
-	Text      string `json:"text,omitempty"`
-}
-
-type User struct {
-	ID           int64  `json:"id"`
-	IsBot        bool   `json:"is_bot"`
-	FirstName    string `json:"first_name"`
-	LastName     string `json:"last_name,omitempty"`
-	Username     string `json:"username,omitempty"`
-	LanguageCode string `json:"language_code,omitempty"`
-}
-
-type Chat struct {
-	ID        int64  `json:"id"`
-	Type      string `json:"type"`
-	Title     string `json:"title,omitempty"`
-	Username  string `json:"username,omitempty"`
-	FirstName string `json:"first_name,omitempty"`
-	LastName  string `json:"last_name,omitempty"`
-}
-
-type CallbackQuery struct {
-	ID      string   `json:"id"`
-	From    *User    `json:"from"`
-	Message *Message `json:"message,omitempty"`
-	Data    string   `json:"data,omitempty"`
+// IncomingMessage is the envelope the gateway publishes; Update holds the raw Telegram update.
+// Gateway events, such as chat_migrated, come with Event instead.
+type IncomingMessage struct {
+	BotID  string          `json:"bot_id"`
+	Update json.RawMessage `json:"update,omitempty"`
+	Event  json.RawMessage `json:"event,omitempty"`
 }
 
+// OutgoingCommand carries no bot token, the gateway sends as the bot the topic belongs to
 type OutgoingCommand struct {
-	BotToken string                 `json:"bot_token"`
-	Method   string                 `json:"method"`
-	Params   map[string]interface{} `json:"params"`
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+	// RequestID makes the gateway publish the outcome to bot_<id>_results
+	RequestID string `json:"request_id,omitempty"`
+	// Attachments are files uploaded with the call, referenced from params as attach://<name>
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
-type InlineQuery struct {
-	ID     string `json:"id"`
-	From   *User  `json:"from"`
-	Query  string `json:"query"`
-	Offset string `json:"offset"`
+type Attachment struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data"`
 }
@@ -28,6 +28,10 @@ func NewServer(handlers *handlers.Handlers, logger *zap.SugaredLogger) *Server {
 func (s *Server) SetupRoutes() {
 	s.app.Get("/bot:token/getMe", s.handlers.GetMe)
 	s.app.Get("/bot:token/getUpdates", s.handlers.GetUpdates)
+	s.app.Post("/bot:token/getUpdates", s.handlers.GetUpdates)
+	s.app.Get("/bot:token/getFile", s.handlers.GetFile)
+	s.app.Post("/bot:token/getFile", s.handlers.GetFile)
+	s.app.Get("/file/bot:token/*", s.handlers.DownloadFile)
 	s.app.Post("/bot:token/:method", s.handlers.CallMethod)
 
 	s.app.Get("/health", healthHandler)
@@ -0,0 +1,73 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Client forwards the calls that need a synchronous answer from the Bot API,
+// such as getFile and file downloads, to the bot's Bot API server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *zap.SugaredLogger
+}
+
+func NewClient(baseURL string, logger *zap.SugaredLogger) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+		logger: logger,
+	}
+}
+
+// GetFile calls getFile and returns the raw Bot API response body and status code
+func (c *Client) GetFile(ctx context.Context, botToken, fileID string) ([]byte, int, error) {
+	endpoint := fmt.Sprintf("%s/bot%s/getFile", c.baseURL, botToken)
+	form := url.Values{"file_id": {fileID}}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return body, resp.StatusCode, nil
+}
+
+// DownloadFile opens a download of file_path from /file/bot<token>/
+func (c *Client) DownloadFile(ctx context.Context, botToken, filePath string) (*http.Response, error) {
+	endpoint := fmt.Sprintf("%s/file/bot%s/%s", c.baseURL, botToken, strings.TrimPrefix(filePath, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,260 @@
+package updates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	kafkapkg "github.com/uchebnick/telegram-serverless/tg_proxy/internal/kafka"
+	"github.com/uchebnick/telegram-serverless/tg_proxy/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxLimit and maxTimeout bound a single getUpdates call
+	maxLimit   = 100
+	maxTimeout = 50 * time.Second
+
+	// linger is how long a call that already has updates waits for more that are on their way
+	linger = 50 * time.Millisecond
+)
+
+// defaultExcluded are the update types Telegram only sends when allowed_updates asks for them
+var defaultExcluded = []string{"chat_member", "message_reaction", "message_reaction_count"}
+
+// Params are the getUpdates parameters
+type Params struct {
+	Offset         int64
+	Limit          int
+	Timeout        time.Duration
+	AllowedUpdates []string // nil keeps the list of the previous call
+}
+
+// consumer is what the queue needs of the Kafka consumer
+type consumer interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// entry is a message of the incoming topic that isn't committed yet
+type entry struct {
+	msg        kafka.Message
+	updateID   int64
+	updateType string
+	update     json.RawMessage // nil for gateway events and malformed messages
+	delivered  bool
+	confirmed  bool
+}
+
+// Queue serves the incoming topic through getUpdates. Like the Bot API, it keeps
+// updates until a later call's offset confirms them; only then are their Kafka
+// offsets committed, so updates a worker never processed are read again after a restart.
+type Queue struct {
+	consumer consumer
+	logger   *zap.SugaredLogger
+
+	// mu serializes getUpdates calls, which the Bot API doesn't run concurrently either
+	mu             sync.Mutex
+	pending        []*entry // in fetch order
+	allowedUpdates []string
+}
+
+func NewQueue(consumer *kafkapkg.Consumer, logger *zap.SugaredLogger) *Queue {
+	return &Queue{
+		consumer: consumer,
+		logger:   logger,
+	}
+}
+
+// GetUpdates confirms the updates before params.Offset and returns up to params.Limit
+// updates, waiting up to params.Timeout for the first one to arrive
+func (q *Queue) GetUpdates(ctx context.Context, params Params) ([]json.RawMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if params.AllowedUpdates != nil {
+		q.allowedUpdates = params.AllowedUpdates
+	}
+
+	limit := params.Limit
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+
+	q.confirm(params.Offset)
+	q.commitConfirmed()
+
+	if err := q.fetch(ctx, limit, min(params.Timeout, maxTimeout)); err != nil {
+		return nil, err
+	}
+
+	return q.take(limit), nil
+}
+
+// confirm marks what the offset acknowledges. A positive offset confirms the delivered
+// updates below it, along with those filtered out by allowed_updates; a negative one
+// forgets all but the last -offset updates.
+func (q *Queue) confirm(offset int64) {
+	if offset < 0 {
+		waiting := q.waiting()
+		if keep := int(-offset); len(waiting) > keep {
+			for _, e := range waiting[:len(waiting)-keep] {
+				e.confirmed = true
+			}
+		}
+		return
+	}
+
+	for _, e := range q.pending {
+		if e.update == nil {
+			// Gateway events and malformed messages aren't for getUpdates clients
+			e.confirmed = true
+			continue
+		}
+		if e.updateID < offset && (e.delivered || !q.allowed(e.updateType)) {
+			e.confirmed = true
+		}
+	}
+}
+
+// partition identifies a partition among the incoming and route topics
+type partition struct {
+	topic string
+	id    int
+}
+
+// commitConfirmed commits, per partition, the confirmed messages that aren't preceded
+// by an unconfirmed one
+func (q *Queue) commitConfirmed() {
+	blocked := make(map[partition]bool)
+	var commits []kafka.Message
+
+	kept := q.pending[:0]
+	for _, e := range q.pending {
+		p := partition{e.msg.Topic, e.msg.Partition}
+		if e.confirmed && !blocked[p] {
+			commits = append(commits, e.msg)
+			continue
+		}
+		blocked[p] = true
+		kept = append(kept, e)
+	}
+	clear(q.pending[len(kept):])
+	q.pending = kept
+
+	if len(commits) == 0 {
+		return
+	}
+	// A failed commit only means the updates are read again after a restart
+	if err := q.consumer.CommitMessages(context.Background(), commits...); err != nil {
+		q.logger.Errorw("failed to commit updates", "error", err)
+	}
+}
+
+// fetch reads the topic until limit updates are waiting or, if none are, until timeout
+// passes. Once an update is waiting it only picks up what is already on its way.
+func (q *Queue) fetch(ctx context.Context, limit int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		waiting := len(q.waiting())
+		if waiting >= limit {
+			return nil
+		}
+
+		wait := time.Until(deadline)
+		if waiting > 0 || wait < linger {
+			wait = linger
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, wait)
+		msg, err := q.consumer.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+
+		q.pending = append(q.pending, q.parse(msg))
+	}
+}
+
+func (q *Queue) parse(msg kafka.Message) *entry {
+	e := &entry{msg: msg}
+
+	var incoming models.IncomingMessage
+	if err := json.Unmarshal(msg.Value, &incoming); err != nil || len(incoming.Update) == 0 {
+		if err != nil || len(incoming.Event) == 0 {
+			q.logger.Errorw("failed to parse message", "error", err, "offset", msg.Offset)
+		}
+		return e
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(incoming.Update, &fields); err != nil {
+		q.logger.Errorw("failed to parse update", "error", err, "offset", msg.Offset)
+		return e
+	}
+	if err := json.Unmarshal(fields["update_id"], &e.updateID); err != nil {
+		q.logger.Errorw("update without update_id", "offset", msg.Offset)
+		return e
+	}
+
+	// Besides update_id an update has exactly one field, named after its type
+	for name := range fields {
+		if name != "update_id" {
+			e.updateType = name
+		}
+	}
+	e.update = incoming.Update
+	return e
+}
+
+// waiting returns the updates the client asked for and hasn't confirmed, by update_id
+func (q *Queue) waiting() []*entry {
+	var waiting []*entry
+	for _, e := range q.pending {
+		if !e.confirmed && e.update != nil && q.allowed(e.updateType) {
+			waiting = append(waiting, e)
+		}
+	}
+
+	// Partitions interleave, the client expects ascending ids
+	sort.SliceStable(waiting, func(i, j int) bool {
+		return waiting[i].updateID < waiting[j].updateID
+	})
+	return waiting
+}
+
+// take returns the first limit waiting updates and marks them delivered
+func (q *Queue) take(limit int) []json.RawMessage {
+	waiting := q.waiting()
+	if len(waiting) > limit {
+		waiting = waiting[:limit]
+	}
+
+	updates := make([]json.RawMessage, 0, len(waiting))
+	for _, e := range waiting {
+		e.delivered = true
+		updates = append(updates, e.update)
+	}
+	return updates
+}
+
+// allowed applies allowed_updates; an empty list means every type but the opt-in ones
+func (q *Queue) allowed(updateType string) bool {
+	if len(q.allowedUpdates) == 0 {
+		return !slices.Contains(defaultExcluded, updateType)
+	}
+	return slices.Contains(q.allowedUpdates, updateType)
+}
@@ -0,0 +1,159 @@
+package updates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// fakeConsumer hands out msgs in order and records what gets committed
+type fakeConsumer struct {
+	msgs      []kafka.Message
+	committed []kafka.Message
+}
+
+func (c *fakeConsumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(c.msgs) == 0 {
+		return kafka.Message{}, context.DeadlineExceeded
+	}
+	msg := c.msgs[0]
+	c.msgs = c.msgs[1:]
+	return msg, nil
+}
+
+func (c *fakeConsumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	c.committed = append(c.committed, msgs...)
+	return nil
+}
+
+// update builds an incoming message at partition/offset carrying an update of updateType
+func update(partition int, offset, updateID int64, updateType string) kafka.Message {
+	value := fmt.Sprintf(`{"bot_id":"1","update":{"update_id":%d,%q:{}}}`, updateID, updateType)
+	return kafka.Message{Topic: "bot_1_incoming", Partition: partition, Offset: offset, Value: []byte(value)}
+}
+
+func event(partition int, offset int64) kafka.Message {
+	value := `{"bot_id":"1","event":{"type":"bot_updated"}}`
+	return kafka.Message{Topic: "bot_1_incoming", Partition: partition, Offset: offset, Value: []byte(value)}
+}
+
+func updateIDs(t *testing.T, updates []json.RawMessage) []int64 {
+	t.Helper()
+	ids := make([]int64, 0, len(updates))
+	for _, raw := range updates {
+		var u struct {
+			UpdateID int64 `json:"update_id"`
+		}
+		if err := json.Unmarshal(raw, &u); err != nil {
+			t.Fatalf("failed to parse update %s: %v", raw, err)
+		}
+		ids = append(ids, u.UpdateID)
+	}
+	return ids
+}
+
+func TestQueueGetUpdates(t *testing.T) {
+	type call struct {
+		params Params
+
+		wantIDs       []int64
+		wantCommitted []int64 // offsets committed by this call, in commit order
+	}
+
+	tests := []struct {
+		name  string
+		msgs  []kafka.Message
+		calls []call
+	}{
+		{
+			name: "offset confirms delivered updates",
+			msgs: []kafka.Message{update(0, 10, 1, "message"), update(0, 11, 2, "message")},
+			calls: []call{
+				{params: Params{}, wantIDs: []int64{1, 2}},
+				// Delivered but unconfirmed updates come again, like in the Bot API
+				{params: Params{Offset: 2}, wantIDs: []int64{2}, wantCommitted: []int64{10}},
+				{params: Params{Offset: 3}, wantCommitted: []int64{11}},
+			},
+		},
+		{
+			name: "undelivered updates aren't confirmed",
+			msgs: []kafka.Message{update(0, 10, 1, "message"), update(0, 11, 2, "message")},
+			calls: []call{
+				{params: Params{Limit: 1}, wantIDs: []int64{1}},
+				{params: Params{Offset: 3, Limit: 1}, wantIDs: []int64{2}, wantCommitted: []int64{10}},
+			},
+		},
+		{
+			name: "partitions interleave by update_id and commit on their own",
+			msgs: []kafka.Message{update(0, 10, 1, "message"), update(1, 20, 2, "message"), update(0, 11, 3, "message")},
+			calls: []call{
+				{params: Params{Limit: 2}, wantIDs: []int64{1, 2}},
+				{params: Params{Offset: 3, Limit: 2}, wantIDs: []int64{3}, wantCommitted: []int64{10, 20}},
+			},
+		},
+		{
+			name: "a pending message holds back later ones of its partition",
+			msgs: []kafka.Message{update(0, 10, 2, "message"), update(0, 11, 1, "message")},
+			calls: []call{
+				{params: Params{}, wantIDs: []int64{1, 2}},
+				{params: Params{Offset: 2}, wantIDs: []int64{2}},
+				{params: Params{Offset: 3}, wantCommitted: []int64{10, 11}},
+			},
+		},
+		{
+			name: "filtered updates and events are confirmed with the offset",
+			msgs: []kafka.Message{update(0, 10, 1, "message"), event(0, 11), update(0, 12, 2, "callback_query")},
+			calls: []call{
+				{params: Params{AllowedUpdates: []string{"message"}}, wantIDs: []int64{1}},
+				{params: Params{Offset: 3}, wantCommitted: []int64{10, 11, 12}},
+			},
+		},
+		{
+			name: "opt-in types are left out by default",
+			msgs: []kafka.Message{update(0, 10, 1, "chat_member"), update(0, 11, 2, "message")},
+			calls: []call{
+				{params: Params{}, wantIDs: []int64{2}},
+			},
+		},
+		{
+			name: "negative offset keeps only the last updates",
+			msgs: []kafka.Message{update(0, 10, 1, "message"), update(0, 11, 2, "message"), update(0, 12, 3, "message")},
+			calls: []call{
+				{params: Params{}, wantIDs: []int64{1, 2, 3}},
+				{params: Params{Offset: -1}, wantIDs: []int64{3}, wantCommitted: []int64{10, 11}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consumer := &fakeConsumer{msgs: tt.msgs}
+			queue := &Queue{consumer: consumer, logger: zap.NewNop().Sugar()}
+
+			for i, c := range tt.calls {
+				consumer.committed = nil
+
+				updates, err := queue.GetUpdates(context.Background(), c.params)
+				if err != nil {
+					t.Fatalf("call %d: GetUpdates() error = %v", i, err)
+				}
+				if ids := updateIDs(t, updates); !slices.Equal(ids, c.wantIDs) {
+					t.Errorf("call %d: got updates %v, want %v", i, ids, c.wantIDs)
+				}
+
+				var committed []int64
+				for _, msg := range consumer.committed {
+					committed = append(committed, msg.Offset)
+				}
+				if !slices.Equal(committed, c.wantCommitted) {
+					t.Errorf("call %d: committed offsets %v, want %v", i, committed, c.wantCommitted)
+				}
+			}
+		})
+	}
+}
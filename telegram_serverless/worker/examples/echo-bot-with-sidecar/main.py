@@ -17,7 +17,6 @@ from kafka.errors import KafkaError
 
 # Configuration from environment variables
 BOT_ID = os.getenv('BOT_ID')
-BOT_TOKEN = os.getenv('BOT_TOKEN')
 KAFKA_BROKERS = os.getenv('KAFKA_BROKERS', 'localhost:9092').split(',')
 INCOMING_TOPIC = os.getenv('KAFKA_INCOMING_TOPIC')
 OUTGOING_TOPIC = os.getenv('KAFKA_OUTGOING_TOPIC')
@@ -25,7 +24,7 @@ CONSUMER_GROUP = os.getenv('KAFKA_CONSUMER_GROUP')
 SIDECAR_URL = os.getenv('SIDECAR_URL', 'http://localhost:8081')
 
 # Validate required env vars
-required_vars = ['BOT_ID', 'BOT_TOKEN', 'KAFKA_INCOMING_TOPIC', 'KAFKA_OUTGOING_TOPIC', 'CONSUMER_GROUP']
+required_vars = ['BOT_ID', 'KAFKA_INCOMING_TOPIC', 'KAFKA_OUTGOING_TOPIC', 'CONSUMER_GROUP']
 for var in required_vars:
     if not os.getenv(var):
         print(f"ERROR: {var} environment variable is required", file=sys.stderr)
@@ -110,7 +109,6 @@ try:
 
                 # Send echo response
                 response = {
-                    'bot_token': BOT_TOKEN,
                     'method': 'sendMessage',
                     'params': {
                         'chat_id': chat_id,
@@ -133,7 +131,6 @@ try:
 
                 # Answer callback query
                 response = {
-                    'bot_token': BOT_TOKEN,
                     'method': 'answerCallbackQuery',
                     'params': {
                         'callback_query_id': callback_id,
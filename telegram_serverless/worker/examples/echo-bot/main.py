@@ -14,14 +14,13 @@ from kafka.errors import KafkaError
 
 # Configuration from environment variables
 BOT_ID = os.getenv('BOT_ID')
-BOT_TOKEN = os.getenv('BOT_TOKEN')
 KAFKA_BROKERS = os.getenv('KAFKA_BROKERS', 'localhost:9092').split(',')
 INCOMING_TOPIC = os.getenv('KAFKA_INCOMING_TOPIC')
 OUTGOING_TOPIC = os.getenv('KAFKA_OUTGOING_TOPIC')
 CONSUMER_GROUP = os.getenv('KAFKA_CONSUMER_GROUP')
 
 # Validate required env vars
-required_vars = ['BOT_ID', 'BOT_TOKEN', 'KAFKA_INCOMING_TOPIC', 'KAFKA_OUTGOING_TOPIC', 'CONSUMER_GROUP']
+required_vars = ['BOT_ID', 'KAFKA_INCOMING_TOPIC', 'KAFKA_OUTGOING_TOPIC', 'CONSUMER_GROUP']
 for var in required_vars:
     if not os.getenv(var):
         print(f"ERROR: {var} environment variable is required", file=sys.stderr)
@@ -82,7 +81,6 @@ try:
 
                 # Send echo response
                 response = {
-                    'bot_token': BOT_TOKEN,
                     'method': 'sendMessage',
                     'params': {
                         'chat_id': chat_id,
@@ -105,7 +103,6 @@ try:
 
                 # Answer callback query
                 response = {
-                    'bot_token': BOT_TOKEN,
                     'method': 'answerCallbackQuery',
                     'params': {
                         'callback_query_id': callback_id,